@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"time"
+)
+
+// alertRetentionLockKey is held by the replica running the retention job for
+// the current interval.
+const alertRetentionLockKey = "lock:alert-retention"
+
+// Alert retention policy, enforced by runAlertRetention. alertRetention of 0
+// disables it. Set by ALERT_RETENTION, ALERT_RETENTION_INTERVAL and
+// ALERT_RETENTION_MODE.
+var (
+	alertRetention         time.Duration
+	alertRetentionInterval = time.Hour
+	alertRetentionMode     = "archive"
+)
+
+// initAlertRetention reads the retention policy from the environment.
+func initAlertRetention() {
+	alertRetention = getEnvDuration("ALERT_RETENTION", alertRetention)
+	alertRetentionInterval = getEnvDuration("ALERT_RETENTION_INTERVAL", alertRetentionInterval)
+	alertRetentionMode = getEnv("ALERT_RETENTION_MODE", alertRetentionMode)
+	if alertRetentionMode != "archive" && alertRetentionMode != "delete" {
+		log.Fatalf("Invalid ALERT_RETENTION_MODE=%q: must be archive or delete", alertRetentionMode)
+	}
+	if alertRetention > 0 && alertRetention < minPurgeAge {
+		log.Fatalf("ALERT_RETENTION must be at least %s", minPurgeAge)
+	}
+	if alertRetentionInterval <= 0 {
+		log.Fatal("ALERT_RETENTION_INTERVAL must be positive")
+	}
+}
+
+// runAlertRetention applies the retention policy every alertRetentionInterval
+// until ctx is cancelled. Each replica runs it, but only the one that takes
+// the Redis lock does the work. The lock is left to expire at the end of the
+// interval rather than released, so replicas whose tickers fire later in the
+// same interval skip it too.
+func runAlertRetention(ctx context.Context) {
+	if alertRetention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(alertRetentionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			locked, err := redisClient.SetNX(ctx, alertRetentionLockKey, "1", alertRetentionInterval).Result()
+			if err != nil {
+				slog.Warn("Failed to take alert retention lock, skipping run", "error", err)
+				continue
+			}
+			if !locked {
+				continue
+			}
+			// A run that outlasts its lock could overlap the next holder's.
+			runCtx, cancel := context.WithTimeout(ctx, alertRetentionInterval)
+			enforceAlertRetention(runCtx)
+			cancel()
+		}
+	}
+}
+
+// enforceAlertRetention archives or deletes alerts of every tenant created
+// before the retention cutoff. Archiving soft-deletes live alerts the way
+// DELETE /alerts/:id does, audit record included, so they can still be
+// restored; deleting removes them, archived ones too. Both go
+// purgeBatchSize rows at a time, so an interrupted run resumes next time.
+func enforceAlertRetention(ctx context.Context) {
+	// Columns are TIMESTAMP without time zone and written in UTC.
+	cutoff := time.Now().UTC().Add(-alertRetention)
+	query := `DELETE FROM alerts WHERE id IN (
+			SELECT id FROM alerts WHERE created_at < $1 LIMIT $2
+		)`
+	if alertRetentionMode == "archive" {
+		query = `WITH archived AS (
+				UPDATE alerts SET deleted_at = LOCALTIMESTAMP
+				WHERE id IN (SELECT id FROM alerts WHERE deleted_at IS NULL AND created_at < $1 LIMIT $2)
+				RETURNING id, status
+			)
+			INSERT INTO alert_audit (alert_id, action, old_status, new_status, changed_by)
+			SELECT id, 'deletion', status, status, 'retention' FROM archived`
+	}
+
+	var total int64
+	for {
+		result, err := db.ExecContext(ctx, query, cutoff, purgeBatchSize)
+		if err != nil {
+			slog.Warn("Alert retention run failed", "mode", alertRetentionMode, "cutoff", cutoff, "alerts", total, "error", err)
+			return
+		}
+		n, _ := result.RowsAffected()
+		total += n
+		if n < purgeBatchSize {
+			break
+		}
+	}
+	if total > 0 {
+		slog.Info("Applied alert retention", "mode", alertRetentionMode, "cutoff", cutoff, "alerts", total)
+	}
+}
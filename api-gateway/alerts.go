@@ -0,0 +1,512 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Allowed values for the alerts.status and alerts.severity columns; these
+// match the CHECK constraints in database/schema.sql.
+var (
+	validAlertStatuses   = []string{"new", "acknowledged", "resolved", "false_positive"}
+	validAlertSeverities = []string{"low", "medium", "high", "critical"}
+)
+
+// severityRank orders severities from low (0) to critical (3); unknown
+// values rank below low.
+func severityRank(severity string) int {
+	for i, s := range validAlertSeverities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+// Alert mirrors a row of the alerts table. Nullable columns are pointers so
+// they serialize as JSON null rather than empty strings.
+type Alert struct {
+	ID             string     `json:"id"`
+	TenantID       string     `json:"tenant_id"`
+	PredictionID   *string    `json:"prediction_id"`
+	ThreatID       *string    `json:"threat_id"`
+	Severity       string     `json:"severity"`
+	Status         string     `json:"status"`
+	Description    *string    `json:"description"`
+	SourceIP       *string    `json:"source_ip"`
+	DestinationIP  *string    `json:"destination_ip"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at"`
+	AcknowledgedBy *string    `json:"acknowledged_by"`
+	ResolvedAt     *time.Time `json:"resolved_at"`
+	ResolvedBy     *string    `json:"resolved_by"`
+	AssignedTo     *string    `json:"assigned_to"`
+	IncidentID     *string    `json:"incident_id"`
+	Notes          *string    `json:"notes"`
+	Occurrences    int        `json:"occurrence_count"`
+	LastSeenAt     time.Time  `json:"last_seen_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	DeletedAt      *time.Time `json:"deleted_at"`
+}
+
+const alertColumns = `id, tenant_id, prediction_id, threat_id, severity, status, description, source_ip, destination_ip,
+	acknowledged_at, acknowledged_by, resolved_at, resolved_by, assigned_to, incident_id, notes, occurrence_count, last_seen_at, created_at, updated_at, deleted_at`
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// isValidUUID reports whether s looks like a UUID, so malformed IDs can be
+// rejected with a 400 before Postgres rejects them with a cast error.
+func isValidUUID(s string) bool {
+	return uuidPattern.MatchString(s)
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAlert(s rowScanner) (Alert, error) {
+	var a Alert
+	err := s.Scan(
+		&a.ID, &a.TenantID, &a.PredictionID, &a.ThreatID, &a.Severity, &a.Status, &a.Description, &a.SourceIP, &a.DestinationIP,
+		&a.AcknowledgedAt, &a.AcknowledgedBy, &a.ResolvedAt, &a.ResolvedBy, &a.AssignedTo, &a.IncidentID, &a.Notes, &a.Occurrences, &a.LastSeenAt, &a.CreatedAt, &a.UpdatedAt, &a.DeletedAt,
+	)
+	return a, err
+}
+
+// alertFilters builds the WHERE clause shared by the alert list endpoints from
+// the request's filter query params. The clause always restricts rows to the
+// caller's tenant and starts with " WHERE ". Filters combine with AND. A new
+// filter param also goes into alertFilterNames.
+func alertFilters(c *gin.Context) (string, []interface{}) {
+	args := []interface{}{tenantFromContext(c)}
+	conditions := []string{"tenant_id = $1"}
+
+	// Soft-deleted alerts are hidden unless ?include_deleted=true.
+	if c.Query("include_deleted") != "true" {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+
+	if severity := c.Query("severity"); severity != "" {
+		args = append(args, severity)
+		conditions = append(conditions, fmt.Sprintf("severity = $%d", len(args)))
+	}
+	if status := c.Query("status"); status != "" {
+		args = append(args, status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+	// ?unassigned=true selects the triage queue nobody has picked up yet and
+	// takes precedence over ?assigned_to=.
+	if c.Query("unassigned") == "true" {
+		conditions = append(conditions, "assigned_to IS NULL")
+	} else if assignee := c.Query("assigned_to"); assignee != "" {
+		args = append(args, assignee)
+		conditions = append(conditions, fmt.Sprintf("assigned_to = $%d", len(args)))
+	}
+	// ?q= is a case-insensitive substring match over the free-text and address
+	// columns. The term is matched literally, so LIKE wildcards are escaped.
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		args = append(args, "%"+likeEscaper.Replace(q)+"%")
+		n := len(args)
+		conditions = append(conditions, fmt.Sprintf(
+			"(description ILIKE $%[1]d OR notes ILIKE $%[1]d OR source_ip ILIKE $%[1]d OR destination_ip ILIKE $%[1]d)", n))
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// likeEscaper escapes the LIKE metacharacters using Postgres' default escape
+// character, the backslash.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func getAlerts(c *gin.Context) {
+	page, err := parsePage(c, defaultPageSpec)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		getAlertsByCursor(c, cursor, page.Limit)
+		return
+	}
+
+	where, args := alertFilters(c)
+
+	var total int
+	// Both queries go to one pool so the total matches the page.
+	rdb := readDB()
+	if err := rdb.QueryRowContext(c.Request.Context(), "SELECT COUNT(*) FROM alerts"+where, args...).Scan(&total); err != nil {
+		requestLog(c).Error("Failed to count alerts", "error", err)
+		internalError(c, "failed to fetch alerts")
+		return
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM alerts%s ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d",
+		alertColumns, where, len(args)+1, len(args)+2)
+	rows, err := rdb.QueryContext(c.Request.Context(), query, append(args, page.Limit, page.Offset())...)
+	if err != nil {
+		requestLog(c).Error("Failed to query alerts", "error", err)
+		internalError(c, "failed to fetch alerts")
+		return
+	}
+	defer rows.Close()
+
+	alerts := []Alert{}
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			requestLog(c).Error("Failed to scan alert", "error", err)
+			internalError(c, "failed to fetch alerts")
+			return
+		}
+		alerts = append(alerts, a)
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(c).Error("Failed to iterate alerts", "error", err)
+		internalError(c, "failed to fetch alerts")
+		return
+	}
+
+	setPageLinks(c, total, page)
+	respond(c, 200, alerts, gin.H{"pagination": newPagination(total, page)})
+}
+
+// alertCursor is the keyset position of the last alert on a page. It is sent
+// to clients as opaque base64-encoded JSON.
+type alertCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"id"`
+}
+
+func encodeAlertCursor(a Alert) string {
+	payload, _ := json.Marshal(alertCursor{CreatedAt: a.CreatedAt.UTC(), ID: a.ID})
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+func decodeAlertCursor(token string) (alertCursor, error) {
+	var cur alertCursor
+	payload, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cur, err
+	}
+	if err := json.Unmarshal(payload, &cur); err != nil {
+		return cur, err
+	}
+	if cur.CreatedAt.IsZero() || !isValidUUID(cur.ID) {
+		return cur, errors.New("incomplete cursor")
+	}
+	return cur, nil
+}
+
+// getAlertsByCursor serves getAlerts in keyset mode (?cursor=): pages are
+// sliced by (created_at, id) rather than OFFSET, so deep pages cost the same
+// as the first. An empty cursor starts from the newest alert; next_cursor is
+// null on the last page.
+func getAlertsByCursor(c *gin.Context, token string, limit int) {
+	where, args := alertFilters(c)
+	if token != "" {
+		cur, err := decodeAlertCursor(token)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid cursor"})
+			return
+		}
+		args = append(args, cur.CreatedAt, cur.ID)
+		where += fmt.Sprintf(" AND (created_at, id) < ($%d::timestamp, $%d::uuid)", len(args)-1, len(args))
+	}
+
+	// Fetch one extra row to learn whether another page follows.
+	query := fmt.Sprintf("SELECT %s FROM alerts%s ORDER BY created_at DESC, id DESC LIMIT $%d",
+		alertColumns, where, len(args)+1)
+	rows, err := readDB().QueryContext(c.Request.Context(), query, append(args, limit+1)...)
+	if err != nil {
+		requestLog(c).Error("Failed to query alerts", "error", err)
+		internalError(c, "failed to fetch alerts")
+		return
+	}
+	defer rows.Close()
+
+	alerts := []Alert{}
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			requestLog(c).Error("Failed to scan alert", "error", err)
+			internalError(c, "failed to fetch alerts")
+			return
+		}
+		alerts = append(alerts, a)
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(c).Error("Failed to iterate alerts", "error", err)
+		internalError(c, "failed to fetch alerts")
+		return
+	}
+
+	var nextCursor *string
+	if len(alerts) > limit {
+		alerts = alerts[:limit]
+		next := encodeAlertCursor(alerts[limit-1])
+		nextCursor = &next
+		c.Header("Link", pageLink(c, "cursor", next, "next"))
+	}
+
+	respond(c, 200, alerts, gin.H{"next_cursor": nextCursor})
+}
+
+func getAlert(c *gin.Context) {
+	id := c.Param("id")
+	if !isValidUUID(id) {
+		c.JSON(400, gin.H{"error": "invalid alert id"})
+		return
+	}
+
+	alert, err := scanAlert(db.QueryRowContext(c.Request.Context(), "SELECT "+alertColumns+" FROM alerts WHERE id = $1 AND tenant_id = $2", id, tenantFromContext(c)))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"error": "alert not found"})
+		return
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to fetch alert", "alert_id", id, "error", err)
+		internalError(c, "failed to fetch alert")
+		return
+	}
+
+	respondWithETag(c, alert, nil)
+}
+
+// UpdateAlertRequest is the PATCH body for updateAlert. Fields are pointers so
+// that omitted fields can be told apart from empty ones and left untouched.
+// An empty assigned_to unassigns the alert.
+type UpdateAlertRequest struct {
+	Status     *string `json:"status"`
+	Severity   *string `json:"severity"`
+	Notes      *string `json:"notes"`
+	AssignedTo *string `json:"assigned_to"`
+}
+
+func updateAlert(c *gin.Context) {
+	id := c.Param("id")
+	if !isValidUUID(id) {
+		c.JSON(400, gin.H{"error": "invalid alert id"})
+		return
+	}
+
+	var req UpdateAlertRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+		return
+	}
+
+	actor := actorFromContext(c)
+
+	var sets []string
+	var args []interface{}
+
+	if req.Status != nil {
+		if !contains(validAlertStatuses, *req.Status) {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("invalid status %q: must be one of %s", *req.Status, strings.Join(validAlertStatuses, ", "))})
+			return
+		}
+		args = append(args, *req.Status, actor)
+		sets = append(sets, fmt.Sprintf("status = $%d", len(args)-1))
+		sets = append(sets, statusChangeSets(*req.Status, len(args))...)
+	}
+	if req.Severity != nil {
+		if !contains(validAlertSeverities, *req.Severity) {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("invalid severity %q: must be one of %s", *req.Severity, strings.Join(validAlertSeverities, ", "))})
+			return
+		}
+		args = append(args, *req.Severity)
+		sets = append(sets, fmt.Sprintf("severity = $%d", len(args)))
+	}
+	if req.Notes != nil {
+		args = append(args, *req.Notes)
+		sets = append(sets, fmt.Sprintf("notes = $%d", len(args)))
+	}
+	var newAssignee *string
+	if req.AssignedTo != nil {
+		if *req.AssignedTo != "" {
+			newAssignee = req.AssignedTo
+		}
+		args = append(args, newAssignee)
+		sets = append(sets, fmt.Sprintf("assigned_to = $%d", len(args)))
+	}
+
+	if len(sets) == 0 {
+		c.JSON(400, gin.H{"error": "no updatable fields provided (status, severity, notes, assigned_to)"})
+		return
+	}
+
+	// The status change and its audit row are written in one transaction so
+	// the history can never disagree with the alert itself.
+	ctx := c.Request.Context()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		requestLog(c).Error("Failed to begin transaction for alert", "alert_id", id, "error", err)
+		internalError(c, "failed to update alert")
+		return
+	}
+	defer tx.Rollback()
+
+	var oldStatus string
+	var oldAssignee *string
+	err = tx.QueryRowContext(ctx, "SELECT status, assigned_to FROM alerts WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL FOR UPDATE",
+		id, tenantFromContext(c)).Scan(&oldStatus, &oldAssignee)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"error": "alert not found"})
+		return
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to lock alert", "alert_id", id, "error", err)
+		internalError(c, "failed to update alert")
+		return
+	}
+
+	args = append(args, id)
+	query := fmt.Sprintf("UPDATE alerts SET %s WHERE id = $%d RETURNING %s",
+		strings.Join(sets, ", "), len(args), alertColumns)
+
+	alert, err := scanAlert(tx.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		requestLog(c).Error("Failed to update alert", "alert_id", id, "error", err)
+		internalError(c, "failed to update alert")
+		return
+	}
+
+	if req.Status != nil && *req.Status != oldStatus {
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO alert_audit (alert_id, old_status, new_status, changed_by) VALUES ($1, $2, $3, $4)",
+			id, oldStatus, *req.Status, actor,
+		)
+		if err != nil {
+			requestLog(c).Error("Failed to write audit record for alert", "alert_id", id, "error", err)
+			internalError(c, "failed to update alert")
+			return
+		}
+		if *req.Status == "false_positive" {
+			if err := recordFalsePositives(ctx, tx, tenantFromContext(c), actor, []string{id}); err != nil {
+				requestLog(c).Error("Failed to record false-positive feedback", "alert_id", id, "error", err)
+				internalError(c, "failed to update alert")
+				return
+			}
+		}
+	}
+
+	if req.AssignedTo != nil && !sameAssignee(oldAssignee, newAssignee) {
+		_, err = tx.ExecContext(ctx, `INSERT INTO alert_audit (alert_id, action, old_status, new_status, old_assignee, new_assignee, changed_by)
+			VALUES ($1, 'assignment', $2, $2, $3, $4, $5)`,
+			id, alert.Status, oldAssignee, newAssignee, actor,
+		)
+		if err != nil {
+			requestLog(c).Error("Failed to write audit record for alert", "alert_id", id, "error", err)
+			internalError(c, "failed to update alert")
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		requestLog(c).Error("Failed to commit update for alert", "alert_id", id, "error", err)
+		internalError(c, "failed to update alert")
+		return
+	}
+
+	respond(c, 200, alert, nil)
+}
+
+// AlertAuditEntry is a single row of the alert_audit table. Severities are
+// only set on escalations and assignees only on assignments.
+type AlertAuditEntry struct {
+	ID          string    `json:"id"`
+	AlertID     string    `json:"alert_id"`
+	Action      string    `json:"action"`
+	OldStatus   *string   `json:"old_status"`
+	NewStatus   string    `json:"new_status"`
+	OldSeverity *string   `json:"old_severity"`
+	NewSeverity *string   `json:"new_severity"`
+	OldAssignee *string   `json:"old_assignee"`
+	NewAssignee *string   `json:"new_assignee"`
+	ChangedBy   string    `json:"changed_by"`
+	ChangedAt   time.Time `json:"changed_at"`
+}
+
+func getAlertHistory(c *gin.Context) {
+	id := c.Param("id")
+	if !isValidUUID(id) {
+		c.JSON(400, gin.H{"error": "invalid alert id"})
+		return
+	}
+
+	var exists bool
+	rdb := readDB()
+	if err := rdb.QueryRowContext(c.Request.Context(), "SELECT EXISTS (SELECT 1 FROM alerts WHERE id = $1 AND tenant_id = $2)", id, tenantFromContext(c)).Scan(&exists); err != nil {
+		requestLog(c).Error("Failed to check alert", "alert_id", id, "error", err)
+		internalError(c, "failed to fetch alert history")
+		return
+	}
+	if !exists {
+		c.JSON(404, gin.H{"error": "alert not found"})
+		return
+	}
+
+	rows, err := rdb.QueryContext(c.Request.Context(), `SELECT id, alert_id, action, old_status, new_status, old_severity, new_severity, old_assignee, new_assignee, changed_by, changed_at
+		FROM alert_audit WHERE alert_id = $1 ORDER BY changed_at DESC, id DESC`, id)
+	if err != nil {
+		requestLog(c).Error("Failed to query history for alert", "alert_id", id, "error", err)
+		internalError(c, "failed to fetch alert history")
+		return
+	}
+	defer rows.Close()
+
+	history := []AlertAuditEntry{}
+	for rows.Next() {
+		var e AlertAuditEntry
+		if err := rows.Scan(&e.ID, &e.AlertID, &e.Action, &e.OldStatus, &e.NewStatus, &e.OldSeverity, &e.NewSeverity, &e.OldAssignee, &e.NewAssignee, &e.ChangedBy, &e.ChangedAt); err != nil {
+			requestLog(c).Error("Failed to scan audit record", "error", err)
+			internalError(c, "failed to fetch alert history")
+			return
+		}
+		history = append(history, e)
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(c).Error("Failed to iterate history for alert", "alert_id", id, "error", err)
+		internalError(c, "failed to fetch alert history")
+		return
+	}
+
+	respond(c, 200, history, nil)
+}
+
+// statusChangeSets returns the extra SET clauses that accompany moving an
+// alert to status, stamping who did it via the actor placeholder $actorArg.
+func statusChangeSets(status string, actorArg int) []string {
+	switch status {
+	case "acknowledged":
+		return []string{"acknowledged_at = CURRENT_TIMESTAMP", fmt.Sprintf("acknowledged_by = $%d", actorArg)}
+	case "resolved", "false_positive":
+		return []string{"resolved_at = CURRENT_TIMESTAMP", fmt.Sprintf("resolved_by = $%d", actorArg)}
+	}
+	return nil
+}
+
+func sameAssignee(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+const maxBulkUpdateIDs = 500
+
+// BulkUpdateAlertsRequest is the body of POST /alerts/bulk-update.
+type BulkUpdateAlertsRequest struct {
+	IDs    []string `json:"ids" binding:"required"`
+	Status string   `json:"status" binding:"required"`
+}
+
+// BulkUpdateResult reports how many of the requested alerts changed status.
+// Unknown, deleted and unchanged alerts count as requested but not updated.
+type BulkUpdateResult struct {
+	Updated   int64 `json:"updated"`
+	Requested int   `json:"requested"`
+}
+
+func bulkUpdateAlerts(c *gin.Context) {
+	var req BulkUpdateAlertsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+		return
+	}
+	if len(req.IDs) == 0 {
+		c.JSON(400, gin.H{"error": "ids must not be empty"})
+		return
+	}
+	if len(req.IDs) > maxBulkUpdateIDs {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("too many ids: at most %d per request", maxBulkUpdateIDs)})
+		return
+	}
+	for _, id := range req.IDs {
+		if !isValidUUID(id) {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("invalid alert id %q", id)})
+			return
+		}
+	}
+	if !contains(validAlertStatuses, req.Status) {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("invalid status %q: must be one of %s", req.Status, strings.Join(validAlertStatuses, ", "))})
+		return
+	}
+
+	ctx := c.Request.Context()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		requestLog(c).Error("Failed to begin bulk update transaction", "error", err)
+		internalError(c, "failed to update alerts")
+		return
+	}
+	defer tx.Rollback()
+
+	// Only alerts whose status actually changes are updated, and each gets an
+	// audit row, so the returned count is exactly the number of audit entries.
+	tenant, actor := tenantFromContext(c), actorFromContext(c)
+	sets := append([]string{"status = $2"}, statusChangeSets(req.Status, 3)...)
+	rows, err := tx.QueryContext(ctx, `WITH changed AS (
+			SELECT id, status FROM alerts WHERE id = ANY($1::uuid[]) AND tenant_id = $4 AND deleted_at IS NULL
+				AND status IS DISTINCT FROM $2 FOR UPDATE
+		), updated AS (
+			UPDATE alerts a SET `+strings.Join(sets, ", ")+`
+			FROM changed WHERE a.id = changed.id
+			RETURNING a.id, changed.status AS old_status
+		)
+		INSERT INTO alert_audit (alert_id, old_status, new_status, changed_by)
+		SELECT id, old_status, $2::varchar, $3::varchar FROM updated
+		RETURNING alert_id`,
+		pq.Array(req.IDs), req.Status, actor, tenant,
+	)
+	if err != nil {
+		requestLog(c).Error("Failed to bulk update alerts", "error", err)
+		internalError(c, "failed to update alerts")
+		return
+	}
+	changed := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			requestLog(c).Error("Failed to scan updated alert", "error", err)
+			internalError(c, "failed to update alerts")
+			return
+		}
+		changed = append(changed, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		requestLog(c).Error("Failed to bulk update alerts", "error", err)
+		internalError(c, "failed to update alerts")
+		return
+	}
+
+	if req.Status == "false_positive" {
+		if err := recordFalsePositives(ctx, tx, tenant, actor, changed); err != nil {
+			requestLog(c).Error("Failed to record false-positive feedback", "error", err)
+			internalError(c, "failed to update alerts")
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		requestLog(c).Error("Failed to commit bulk update", "error", err)
+		internalError(c, "failed to update alerts")
+		return
+	}
+
+	respond(c, 200, BulkUpdateResult{Updated: int64(len(changed)), Requested: len(req.IDs)}, nil)
+}
+
+const maxBatchGetIDs = 200
+
+// BatchGetAlertsRequest is the body of POST /alerts/batch-get.
+type BatchGetAlertsRequest struct {
+	IDs []string `json:"ids" binding:"required"`
+}
+
+// batchGetAlerts fetches several alerts in one query. Alerts come back in the
+// order they were requested (repeats collapsed), and ids that don't exist in
+// the caller's tenant are listed under not_found.
+func batchGetAlerts(c *gin.Context) {
+	var req BatchGetAlertsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+		return
+	}
+	if len(req.IDs) == 0 {
+		c.JSON(400, gin.H{"error": "ids must not be empty"})
+		return
+	}
+	if len(req.IDs) > maxBatchGetIDs {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("too many ids: at most %d per request", maxBatchGetIDs)})
+		return
+	}
+	for _, id := range req.IDs {
+		if !isValidUUID(id) {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("invalid alert id %q", id)})
+			return
+		}
+	}
+
+	rows, err := db.QueryContext(c.Request.Context(), "SELECT "+alertColumns+" FROM alerts WHERE id = ANY($1::uuid[]) AND tenant_id = $2",
+		pq.Array(req.IDs), tenantFromContext(c))
+	if err != nil {
+		requestLog(c).Error("Failed to query alerts by id", "error", err)
+		internalError(c, "failed to fetch alerts")
+		return
+	}
+	defer rows.Close()
+
+	found := make(map[string]Alert, len(req.IDs))
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			requestLog(c).Error("Failed to scan alert", "error", err)
+			internalError(c, "failed to fetch alerts")
+			return
+		}
+		found[a.ID] = a
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(c).Error("Failed to iterate alerts", "error", err)
+		internalError(c, "failed to fetch alerts")
+		return
+	}
+
+	// Postgres returns UUIDs in lower case, so requested ids are matched the
+	// same way.
+	alerts := make([]Alert, 0, len(found))
+	notFound := []string{}
+	seen := make(map[string]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		key := strings.ToLower(id)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if a, ok := found[key]; ok {
+			alerts = append(alerts, a)
+		} else {
+			notFound = append(notFound, id)
+		}
+	}
+
+	respond(c, 200, alerts, gin.H{"not_found": notFound})
+}
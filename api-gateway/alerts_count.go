@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// alertCountCacheTTL is short because the count backs an "unread" badge,
+// where a new alert should show up within seconds.
+const alertCountCacheTTL = 10 * time.Second
+
+// alertFilterNames are the query params alertFilters reads.
+var alertFilterNames = []string{"severity", "status", "assigned_to", "unassigned", "q", "include_deleted"}
+
+// AlertCount is the body of GET /alerts/count.
+type AlertCount struct {
+	Count int `json:"count"`
+}
+
+// getAlertCount returns only the number of alerts matching the list filters,
+// for badges that don't need the alerts themselves. Counts are cached for
+// alertCountCacheTTL per filter set.
+func getAlertCount(c *gin.Context) {
+	filters := url.Values{}
+	for _, name := range alertFilterNames {
+		if v, ok := c.GetQuery(name); ok {
+			filters.Set(name, v)
+		}
+	}
+	sum := sha256.Sum256([]byte(filters.Encode()))
+	cacheKey := statsCacheKey(tenantFromContext(c), "alert-count", hex.EncodeToString(sum[:8]))
+
+	ctx := c.Request.Context()
+	if cached, err := redisClient.Get(ctx, cacheKey).Result(); err == nil {
+		if count, err := strconv.Atoi(cached); err == nil {
+			respond(c, 200, AlertCount{Count: count}, nil)
+			return
+		}
+	} else if err != redis.Nil {
+		requestLog(c).Warn("Failed to read alert count cache", "error", err)
+	}
+
+	where, args := alertFilters(c)
+	var count int
+	if err := readDB().QueryRowContext(ctx, "SELECT COUNT(*) FROM alerts"+where, args...).Scan(&count); err != nil {
+		requestLog(c).Error("Failed to count alerts", "error", err)
+		internalError(c, "failed to count alerts")
+		return
+	}
+
+	if err := redisClient.Set(ctx, cacheKey, count, alertCountCacheTTL).Err(); err != nil {
+		requestLog(c).Warn("Failed to write alert count cache", "error", err)
+	}
+
+	respond(c, 200, AlertCount{Count: count}, nil)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// alertDedupWindow is how long an open alert keeps absorbing repeat detections
+// of the same threat type from the same source. Each repeat extends it, so a
+// sustained attack stays on one alert. Zero disables correlation.
+var alertDedupWindow = 10 * time.Minute
+
+// correlateAlert looks for an open alert in the tenant for the same source and
+// threat type last seen within alertDedupWindow and, if there is one, bumps its
+// occurrence counter instead of a new alert being raised. It returns nil when
+// there is nothing to correlate with.
+//
+// The transaction-scoped advisory lock serializes concurrent analyses of the
+// same source/type, so two requests can't both miss and insert duplicates.
+func correlateAlert(ctx context.Context, tx *sql.Tx, tenant, sourceIP, threatType string) (*Alert, error) {
+	if alertDedupWindow <= 0 {
+		return nil, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))",
+		"alert-dedup:"+tenant+"|"+sourceIP+"|"+threatType); err != nil {
+		return nil, err
+	}
+
+	alert, err := scanAlert(tx.QueryRowContext(ctx, `UPDATE alerts SET occurrence_count = occurrence_count + 1, last_seen_at = LOCALTIMESTAMP
+		WHERE id = (
+			SELECT a.id FROM alerts a JOIN threats t ON t.id = a.threat_id
+			WHERE a.tenant_id = $1 AND a.source_ip = $2 AND t.threat_type = $3
+				AND a.status IN ('new', 'acknowledged') AND a.deleted_at IS NULL
+				AND a.last_seen_at >= LOCALTIMESTAMP - make_interval(secs => $4)
+			ORDER BY a.last_seen_at DESC
+			LIMIT 1
+		)
+		RETURNING `+alertColumns,
+		tenant, sourceIP, threatType, alertDedupWindow.Seconds(),
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
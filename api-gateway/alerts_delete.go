@@ -0,0 +1,99 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// deleteAlert soft-deletes an alert: the row and its audit history are kept
+// with deleted_at set, and it drops out of the alert lists until restored.
+func deleteAlert(c *gin.Context) {
+	setAlertDeleted(c, true)
+}
+
+// restoreAlert undoes deleteAlert.
+func restoreAlert(c *gin.Context) {
+	setAlertDeleted(c, false)
+}
+
+// setAlertDeleted sets or clears deleted_at and records the change in
+// alert_audit. Deleting a deleted alert or restoring a live one is a 409.
+func setAlertDeleted(c *gin.Context, deleted bool) {
+	verb, action := "restore", "restore"
+	if deleted {
+		verb, action = "delete", "deletion"
+	}
+
+	id := c.Param("id")
+	if !isValidUUID(id) {
+		c.JSON(400, gin.H{"error": "invalid alert id"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		requestLog(c).Error("Failed to begin transaction for alert", "alert_id", id, "error", err)
+		internalError(c, "failed to "+verb+" alert")
+		return
+	}
+	defer tx.Rollback()
+
+	var status string
+	var deletedAt *time.Time
+	err = tx.QueryRowContext(ctx, "SELECT status, deleted_at FROM alerts WHERE id = $1 AND tenant_id = $2 FOR UPDATE",
+		id, tenantFromContext(c)).Scan(&status, &deletedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"error": "alert not found"})
+		return
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to lock alert", "alert_id", id, "error", err)
+		internalError(c, "failed to "+verb+" alert")
+		return
+	}
+	if (deletedAt != nil) == deleted {
+		if deleted {
+			c.JSON(409, gin.H{"error": "alert is already deleted"})
+		} else {
+			c.JSON(409, gin.H{"error": "alert is not deleted"})
+		}
+		return
+	}
+
+	update := "UPDATE alerts SET deleted_at = NULL WHERE id = $1 RETURNING " + alertColumns
+	if deleted {
+		update = "UPDATE alerts SET deleted_at = LOCALTIMESTAMP WHERE id = $1 RETURNING " + alertColumns
+	}
+	alert, err := scanAlert(tx.QueryRowContext(ctx, update, id))
+	if err != nil {
+		requestLog(c).Error("Failed to "+verb+" alert", "alert_id", id, "error", err)
+		internalError(c, "failed to "+verb+" alert")
+		return
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO alert_audit (alert_id, action, old_status, new_status, changed_by)
+		VALUES ($1, $2, $3, $3, $4)`,
+		id, action, status, actorFromContext(c),
+	)
+	if err != nil {
+		requestLog(c).Error("Failed to write audit record for alert", "alert_id", id, "error", err)
+		internalError(c, "failed to "+verb+" alert")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		requestLog(c).Error("Failed to commit "+action+" of alert", "alert_id", id, "error", err)
+		internalError(c, "failed to "+verb+" alert")
+		return
+	}
+
+	if deleted {
+		c.Status(204)
+		return
+	}
+	respond(c, 200, alert, nil)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// alertEscalationsChannel is the Redis pub/sub channel escalation events are
+// published on.
+var alertEscalationsChannel = "alerts:escalated"
+
+// AlertEscalation is the event published when an alert is escalated.
+type AlertEscalation struct {
+	Alert       Alert  `json:"alert"`
+	OldSeverity string `json:"old_severity"`
+	NewSeverity string `json:"new_severity"`
+	EscalatedBy string `json:"escalated_by"`
+}
+
+// nextSeverity returns the level above severity, or false if severity is
+// already the highest (or unknown).
+func nextSeverity(severity string) (string, bool) {
+	rank := severityRank(severity)
+	if rank < 0 || rank+1 >= len(validAlertSeverities) {
+		return "", false
+	}
+	return validAlertSeverities[rank+1], true
+}
+
+// escalateAlert raises an alert's severity by one level and records the
+// change in alert_audit. Critical alerts can't be escalated further (409) and
+// deleted ones are not found (404).
+func escalateAlert(c *gin.Context) {
+	id := c.Param("id")
+	if !isValidUUID(id) {
+		c.JSON(400, gin.H{"error": "invalid alert id"})
+		return
+	}
+
+	actor := actorFromContext(c)
+
+	ctx := c.Request.Context()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		requestLog(c).Error("Failed to begin transaction for alert", "alert_id", id, "error", err)
+		internalError(c, "failed to escalate alert")
+		return
+	}
+	defer tx.Rollback()
+
+	var severity, status string
+	err = tx.QueryRowContext(ctx, "SELECT severity, status FROM alerts WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL FOR UPDATE",
+		id, tenantFromContext(c)).Scan(&severity, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"error": "alert not found"})
+		return
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to lock alert", "alert_id", id, "error", err)
+		internalError(c, "failed to escalate alert")
+		return
+	}
+
+	next, ok := nextSeverity(severity)
+	if !ok {
+		c.JSON(409, gin.H{"error": "alert is already at " + severity + " severity"})
+		return
+	}
+
+	alert, err := scanAlert(tx.QueryRowContext(ctx, "UPDATE alerts SET severity = $1 WHERE id = $2 RETURNING "+alertColumns, next, id))
+	if err != nil {
+		requestLog(c).Error("Failed to escalate alert", "alert_id", id, "error", err)
+		internalError(c, "failed to escalate alert")
+		return
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO alert_audit (alert_id, action, old_status, new_status, old_severity, new_severity, changed_by)
+		VALUES ($1, 'escalation', $2, $2, $3, $4, $5)`,
+		id, status, severity, next, actor,
+	)
+	if err != nil {
+		requestLog(c).Error("Failed to write audit record for alert", "alert_id", id, "error", err)
+		internalError(c, "failed to escalate alert")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		requestLog(c).Error("Failed to commit escalation for alert", "alert_id", id, "error", err)
+		internalError(c, "failed to escalate alert")
+		return
+	}
+
+	event := AlertEscalation{Alert: alert, OldSeverity: severity, NewSeverity: next, EscalatedBy: actor}
+	if err := publishEscalation(ctx, event); err != nil {
+		requestLog(c).Warn("Failed to publish escalation event", "alert_id", id, "error", err)
+	}
+
+	respond(c, 200, alert, gin.H{"old_severity": severity, "new_severity": next})
+}
+
+func publishEscalation(ctx context.Context, event AlertEscalation) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return redisClient.Publish(ctx, alertEscalationsChannel, payload).Err()
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/errgroup"
+)
+
+// FacetValue is one distinct value of a filterable alert field.
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// AlertFacets holds the distinct values, with counts, of the fields the alert
+// list can be filtered by. Only values present in the data are listed.
+type AlertFacets struct {
+	Severity   []FacetValue `json:"severity"`
+	Status     []FacetValue `json:"status"`
+	ThreatType []FacetValue `json:"threat_type"`
+}
+
+// getAlertFacets returns the distinct severities, statuses and threat types of
+// the tenant's live alerts created since ?since= (see parseSince), so the UI
+// can build its filter dropdowns from the data. Results are cached for
+// statsCacheTTL per window.
+func getAlertFacets(c *gin.Context) {
+	since, err := parseSince(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenant := tenantFromContext(c)
+	cacheKey := statsCacheKey(tenant, "alert-facets", sinceWindow(c, since))
+
+	ctx := c.Request.Context()
+	if cached, err := redisClient.Get(ctx, cacheKey).Bytes(); err == nil {
+		var facets AlertFacets
+		if err := json.Unmarshal(cached, &facets); err == nil {
+			respond(c, 200, facets, gin.H{"since": since})
+			return
+		}
+	} else if err != redis.Nil {
+		requestLog(c).Warn("Failed to read alert facets cache", "error", err)
+	}
+
+	var facets AlertFacets
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() (err error) {
+		facets.Severity, err = queryAlertFacet(gctx, `SELECT severity, COUNT(*) FROM alerts
+			WHERE tenant_id = $1 AND deleted_at IS NULL AND created_at >= $2
+			GROUP BY severity`, tenant, since)
+		return err
+	})
+	g.Go(func() (err error) {
+		facets.Status, err = queryAlertFacet(gctx, `SELECT status, COUNT(*) FROM alerts
+			WHERE tenant_id = $1 AND deleted_at IS NULL AND status IS NOT NULL AND created_at >= $2
+			GROUP BY status`, tenant, since)
+		return err
+	})
+	g.Go(func() (err error) {
+		facets.ThreatType, err = queryAlertFacet(gctx, `SELECT t.threat_type, COUNT(*)
+			FROM alerts a
+			JOIN threats t ON t.id = a.threat_id
+			WHERE a.tenant_id = $1 AND a.deleted_at IS NULL AND t.threat_type IS NOT NULL
+				AND a.created_at >= $2
+			GROUP BY t.threat_type`, tenant, since)
+		return err
+	})
+	if err := g.Wait(); err != nil {
+		requestLog(c).Error("Failed to query alert facets", "error", err)
+		internalError(c, "failed to fetch alert facets")
+		return
+	}
+
+	if payload, err := json.Marshal(facets); err == nil {
+		if err := redisClient.Set(ctx, cacheKey, payload, statsCacheTTL).Err(); err != nil {
+			requestLog(c).Warn("Failed to write alert facets cache", "error", err)
+		}
+	}
+
+	respond(c, 200, facets, gin.H{"since": since})
+}
+
+// queryAlertFacet runs a (value, count) GROUP BY query, most common value
+// first.
+func queryAlertFacet(ctx context.Context, query string, tenant string, since time.Time) ([]FacetValue, error) {
+	rows, err := readDB().QueryContext(ctx, query+" ORDER BY COUNT(*) DESC, 1 ASC", tenant, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []FacetValue{}
+	for rows.Next() {
+		var v FacetValue
+		if err := rows.Scan(&v.Value, &v.Count); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
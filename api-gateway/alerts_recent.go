@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recentAlertsPageSpec caps how many alerts one poll of /alerts/recent can
+// return; a client that is further behind gets has_more and polls again.
+var recentAlertsPageSpec = pageSpec{DefaultLimit: 100, MaxLimit: 500}
+
+// maxUUID sorts after every other id, so a bare timestamp as ?after= selects
+// alerts created strictly later than it.
+const maxUUID = "ffffffff-ffff-ffff-ffff-ffffffffffff"
+
+// getRecentAlerts serves incremental polling: the alerts created after
+// ?after=, oldest first. after is a next_cursor from an earlier call or an
+// RFC3339 timestamp; without it the newest alerts are returned, still oldest
+// first. next_cursor is where the next poll continues and is returned even
+// when nothing new arrived, so clients can keep passing it back. The list
+// filters apply as in getAlerts.
+func getRecentAlerts(c *gin.Context) {
+	page, err := parsePage(c, recentAlertsPageSpec)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	where, args := alertFilters(c)
+	after := c.Query("after")
+	var query string
+	if after != "" {
+		cur, err := parseRecentAfter(after)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		args = append(args, cur.CreatedAt, cur.ID)
+		where += fmt.Sprintf(" AND (created_at, id) > ($%d::timestamp, $%d::uuid)", len(args)-1, len(args))
+		// One extra row tells whether more are waiting.
+		query = fmt.Sprintf("SELECT %s FROM alerts%s ORDER BY created_at, id LIMIT $%d", alertColumns, where, len(args)+1)
+	} else {
+		query = fmt.Sprintf("SELECT * FROM (SELECT %s FROM alerts%s ORDER BY created_at DESC, id DESC LIMIT $%d) newest ORDER BY created_at, id",
+			alertColumns, where, len(args)+1)
+	}
+
+	rows, err := readDB().QueryContext(c.Request.Context(), query, append(args, page.Limit+1)...)
+	if err != nil {
+		requestLog(c).Error("Failed to query recent alerts", "error", err)
+		internalError(c, "failed to fetch alerts")
+		return
+	}
+	defer rows.Close()
+
+	alerts := []Alert{}
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			requestLog(c).Error("Failed to scan alert", "error", err)
+			internalError(c, "failed to fetch alerts")
+			return
+		}
+		alerts = append(alerts, a)
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(c).Error("Failed to iterate alerts", "error", err)
+		internalError(c, "failed to fetch alerts")
+		return
+	}
+
+	hasMore := false
+	if len(alerts) > page.Limit {
+		if after != "" {
+			alerts, hasMore = alerts[:page.Limit], true
+		} else {
+			// Without a cursor the extra row is the oldest of the newest.
+			alerts = alerts[1:]
+		}
+	}
+
+	var nextCursor *string
+	if len(alerts) > 0 {
+		next := encodeAlertCursor(alerts[len(alerts)-1])
+		nextCursor = &next
+	} else if after != "" {
+		nextCursor = &after
+	}
+
+	respond(c, 200, alerts, gin.H{"next_cursor": nextCursor, "has_more": hasMore})
+}
+
+// parseRecentAfter accepts an alert cursor or an RFC3339 timestamp.
+func parseRecentAfter(after string) (alertCursor, error) {
+	if t, err := time.Parse(time.RFC3339, after); err == nil {
+		return alertCursor{CreatedAt: t.UTC(), ID: maxUUID}, nil
+	}
+	cur, err := decodeAlertCursor(after)
+	if err != nil {
+		return cur, fmt.Errorf("invalid after %q: must be a next_cursor or an RFC3339 timestamp", after)
+	}
+	return cur, nil
+}
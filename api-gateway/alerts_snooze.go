@@ -0,0 +1,221 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// maxSnoozeDuration bounds how long a source can be muted in one go.
+const maxSnoozeDuration = 7 * 24 * time.Hour
+
+// snoozeActor is recorded as acknowledged_by on alerts raised for a snoozed
+// source.
+const snoozeActor = "snooze"
+
+// A snooze is stored under snoozeKey with a TTL, so it lapses on its own,
+// and indexed in snoozeIndexKey (a sorted set of source IPs scored by the
+// end of their snooze) so it can be listed without scanning the keyspace.
+func snoozeKey(tenant, sourceIP string) string {
+	return "alert:snooze:" + tenant + ":" + sourceIP
+}
+
+func snoozeIndexKey(tenant string) string {
+	return "alert:snoozes:" + tenant
+}
+
+// Snooze mutes new alerts from a source until Until: while it lasts they are
+// raised already acknowledged and aren't published or sent to webhooks.
+type Snooze struct {
+	SourceIP  string    `json:"source_ip"`
+	AlertID   string    `json:"alert_id"`
+	Until     time.Time `json:"until"`
+	Reason    *string   `json:"reason"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SnoozeAlertRequest is the body of POST /alerts/:id/snooze.
+type SnoozeAlertRequest struct {
+	Duration string  `json:"duration" binding:"required"`
+	Reason   *string `json:"reason"`
+}
+
+// snoozeAlert mutes the source of an alert for the requested duration (e.g.
+// "2h" or "1d", at most maxSnoozeDuration). Snoozing an already snoozed
+// source replaces its snooze.
+func snoozeAlert(c *gin.Context) {
+	var req SnoozeAlertRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+		return
+	}
+	d, err := parseRetention(req.Duration)
+	if err != nil || d <= 0 {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("invalid duration %q: use e.g. 2h or 1d", req.Duration)})
+		return
+	}
+	if d > maxSnoozeDuration {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("duration must be at most %s", maxSnoozeDuration)})
+		return
+	}
+
+	alertID, sourceIP, ok := snoozeSource(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now().UTC()
+	snooze := Snooze{SourceIP: sourceIP, AlertID: alertID, Until: now.Add(d), Reason: req.Reason, CreatedBy: actorFromContext(c), CreatedAt: now}
+	payload, _ := json.Marshal(snooze)
+	tenant := tenantFromContext(c)
+	ctx := c.Request.Context()
+	_, err = redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, snoozeKey(tenant, sourceIP), payload, d)
+		pipe.ZAdd(ctx, snoozeIndexKey(tenant), redis.Z{Score: float64(snooze.Until.Unix()), Member: sourceIP})
+		return nil
+	})
+	if err != nil {
+		requestLog(c).Error("Failed to store snooze", "source_ip", sourceIP, "error", err)
+		internalError(c, "failed to snooze alert source")
+		return
+	}
+
+	requestLog(c).Info("Snoozed alert source", "source_ip", sourceIP, "alert_id", alertID, "until", snooze.Until, "actor", snooze.CreatedBy)
+	respond(c, 200, snooze, nil)
+}
+
+// unsnoozeAlert lifts the snooze on an alert's source. It answers 404 when the
+// source isn't snoozed.
+func unsnoozeAlert(c *gin.Context) {
+	_, sourceIP, ok := snoozeSource(c)
+	if !ok {
+		return
+	}
+
+	tenant := tenantFromContext(c)
+	ctx := c.Request.Context()
+	var deleted *redis.IntCmd
+	_, err := redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		deleted = pipe.Del(ctx, snoozeKey(tenant, sourceIP))
+		pipe.ZRem(ctx, snoozeIndexKey(tenant), sourceIP)
+		return nil
+	})
+	if err != nil {
+		requestLog(c).Error("Failed to remove snooze", "source_ip", sourceIP, "error", err)
+		internalError(c, "failed to unsnooze alert source")
+		return
+	}
+	if deleted.Val() == 0 {
+		c.JSON(404, gin.H{"error": "alert source is not snoozed"})
+		return
+	}
+
+	requestLog(c).Info("Unsnoozed alert source", "source_ip", sourceIP, "actor", actorFromContext(c))
+	c.Status(204)
+}
+
+// snoozeSource resolves the :id alert to its source IP. When that isn't
+// possible it writes the error response and returns false.
+func snoozeSource(c *gin.Context) (string, string, bool) {
+	id := c.Param("id")
+	if !isValidUUID(id) {
+		c.JSON(400, gin.H{"error": "invalid alert id"})
+		return "", "", false
+	}
+
+	var sourceIP *string
+	err := db.QueryRowContext(c.Request.Context(), "SELECT source_ip FROM alerts WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL",
+		id, tenantFromContext(c)).Scan(&sourceIP)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"error": "alert not found"})
+		return "", "", false
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to fetch alert", "alert_id", id, "error", err)
+		internalError(c, "failed to fetch alert")
+		return "", "", false
+	}
+	if sourceIP == nil {
+		c.JSON(409, gin.H{"error": "alert has no source_ip to snooze"})
+		return "", "", false
+	}
+	return id, *sourceIP, true
+}
+
+// listSnoozes returns the tenant's active snoozes, ending soonest first.
+// Lapsed entries are dropped from the index on the way.
+func listSnoozes(c *gin.Context) {
+	page, err := parsePage(c, defaultPageSpec)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	tenant := tenantFromContext(c)
+	ctx := c.Request.Context()
+	index := snoozeIndexKey(tenant)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	if err := redisClient.ZRemRangeByScore(ctx, index, "-inf", "("+now).Err(); err != nil {
+		requestLog(c).Warn("Failed to prune lapsed snoozes", "error", err)
+	}
+	total, err := redisClient.ZCount(ctx, index, now, "+inf").Result()
+	if err != nil {
+		requestLog(c).Error("Failed to count snoozes", "error", err)
+		internalError(c, "failed to list snoozes")
+		return
+	}
+	sources, err := redisClient.ZRangeByScore(ctx, index, &redis.ZRangeBy{
+		Min: now, Max: "+inf", Offset: int64(page.Offset()), Count: int64(page.Limit),
+	}).Result()
+	if err != nil {
+		requestLog(c).Error("Failed to list snoozes", "error", err)
+		internalError(c, "failed to list snoozes")
+		return
+	}
+
+	snoozes := []Snooze{}
+	if len(sources) > 0 {
+		keys := make([]string, len(sources))
+		for i, ip := range sources {
+			keys[i] = snoozeKey(tenant, ip)
+		}
+		values, err := redisClient.MGet(ctx, keys...).Result()
+		if err != nil {
+			requestLog(c).Error("Failed to read snoozes", "error", err)
+			internalError(c, "failed to list snoozes")
+			return
+		}
+		for _, v := range values {
+			// A nil value lapsed between the two reads.
+			s, ok := v.(string)
+			if !ok {
+				continue
+			}
+			var snooze Snooze
+			if err := json.Unmarshal([]byte(s), &snooze); err == nil {
+				snoozes = append(snoozes, snooze)
+			}
+		}
+	}
+
+	setPageLinks(c, int(total), page)
+	respond(c, 200, snoozes, gin.H{"pagination": newPagination(int(total), page)})
+}
+
+// isSourceSnoozed reports whether new alerts from sourceIP are muted. Redis
+// errors count as not snoozed, so an outage can't hide alerts.
+func isSourceSnoozed(c *gin.Context, tenant, sourceIP string) bool {
+	n, err := redisClient.Exists(c.Request.Context(), snoozeKey(tenant, sourceIP)).Result()
+	if err != nil {
+		requestLog(c).Warn("Failed to check alert snooze, raising alert normally", "source_ip", sourceIP, "error", err)
+		return false
+	}
+	return n > 0
+}
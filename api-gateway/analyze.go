@@ -0,0 +1,549 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AnalyzeRequest describes a single traffic sample submitted for scoring.
+// Counters are pointers so that `required` rejects a missing field while
+// still accepting an explicit zero.
+type AnalyzeRequest struct {
+	SourceIP    string   `json:"source_ip" binding:"required,ip"`
+	DestIP      string   `json:"dest_ip" binding:"omitempty,ip"`
+	SourcePort  *int     `json:"source_port" binding:"omitempty,min=0,max=65535"`
+	DestPort    *int     `json:"dest_port" binding:"required,min=0,max=65535"`
+	Protocol    string   `json:"protocol" binding:"required,oneof=tcp udp icmp"`
+	Bytes       *int64   `json:"bytes" binding:"required,min=0"`
+	PacketCount *int64   `json:"packet_count" binding:"required,min=0"`
+	Duration    *float64 `json:"duration" binding:"omitempty,min=0"`
+}
+
+// ScoringConfig holds the tunable thresholds used by scoreTraffic.
+type ScoringConfig struct {
+	MaliciousThreshold  float64 // score at or above which a sample is malicious
+	SuspiciousThreshold float64 // score at or above which a sample is suspicious
+	DoSPacketRate       float64 // packets per second considered flooding, built-in rules only
+	LargeTransferBytes  int64   // single-flow byte count considered exfiltration, built-in rules only
+	UnmatchedLabel      string  // label for samples no rule matched: benign or unknown
+	FeedbackFactor      float64 // score multiplier per false positive of a signature
+	SeverityMedium      float64 // score at or above which an alert is medium, below it low
+	SeverityHigh        float64 // score at or above which an alert is high
+	SeverityCritical    float64 // score at or above which an alert is critical
+}
+
+var scoringConfig ScoringConfig
+
+// analyzePool bounds concurrent scoring; requests that can't get a worker
+// within analyzeQueueTimeout are turned away with a 503.
+var (
+	analyzePool         *workerPool
+	analyzeQueueTimeout = 2 * time.Second
+)
+
+// loadScoringConfig reads ScoringConfig from the environment.
+// ANALYZE_DOS_PACKET_RATE and ANALYZE_LARGE_TRANSFER_BYTES only set the
+// thresholds of defaultScoringRules: the rules seeded into scoring_rules carry
+// their own in their conditions, so while that table has rules those two
+// settings have no effect here.
+func loadScoringConfig() {
+	scoringConfig = ScoringConfig{
+		MaliciousThreshold:  getEnvFloat("ANALYZE_MALICIOUS_THRESHOLD", 0.7),
+		SuspiciousThreshold: getEnvFloat("ANALYZE_SUSPICIOUS_THRESHOLD", 0.4),
+		DoSPacketRate:       getEnvFloat("ANALYZE_DOS_PACKET_RATE", 1000),
+		LargeTransferBytes:  int64(getEnvInt("ANALYZE_LARGE_TRANSFER_BYTES", 10*1024*1024)),
+		UnmatchedLabel:      getEnv("ANALYZE_UNMATCHED_LABEL", "benign"),
+		FeedbackFactor:      getEnvFloat("ANALYZE_FEEDBACK_FACTOR", 0.5),
+		SeverityMedium:      getEnvFloat("ANALYZE_SEVERITY_MEDIUM", 0.5),
+		SeverityHigh:        getEnvFloat("ANALYZE_SEVERITY_HIGH", 0.7),
+		SeverityCritical:    getEnvFloat("ANALYZE_SEVERITY_CRITICAL", 0.9),
+	}
+	if l := scoringConfig.UnmatchedLabel; l != "benign" && l != "unknown" {
+		log.Printf("Invalid ANALYZE_UNMATCHED_LABEL %q, using benign", l)
+		scoringConfig.UnmatchedLabel = "benign"
+	}
+	if f := scoringConfig.FeedbackFactor; f < 0 || f > 1 {
+		log.Printf("Invalid ANALYZE_FEEDBACK_FACTOR %g, using 0.5", f)
+		scoringConfig.FeedbackFactor = 0.5
+	}
+	if c := scoringConfig; !(0 <= c.SeverityMedium && c.SeverityMedium <= c.SeverityHigh && c.SeverityHigh <= c.SeverityCritical && c.SeverityCritical <= 1) {
+		log.Printf("Invalid ANALYZE_SEVERITY_MEDIUM/HIGH/CRITICAL %g/%g/%g, must ascend within 0..1; using 0.5/0.7/0.9",
+			c.SeverityMedium, c.SeverityHigh, c.SeverityCritical)
+		scoringConfig.SeverityMedium, scoringConfig.SeverityHigh, scoringConfig.SeverityCritical = 0.5, 0.7, 0.9
+	}
+}
+
+// Ports commonly targeted by remote-access attacks.
+var sensitivePorts = map[int]bool{21: true, 22: true, 23: true, 445: true, 3389: true}
+
+// Verdict is the outcome of scoring a traffic sample. MatchedRules is only
+// known when the sample was just scored, so it isn't part of the JSON form.
+type Verdict struct {
+	Score        float64       `json:"score"`
+	Label        string        `json:"label"`
+	ThreatType   *string       `json:"threat_type"`
+	MatchedRules []MatchedRule `json:"-"`
+}
+
+// isThreat reports whether the verdict raises an alert. Benign and unknown
+// samples don't.
+func (v Verdict) isThreat() bool {
+	return v.Label == "malicious" || v.Label == "suspicious"
+}
+
+// MatchedRule is a rule that fired for a sample and what it added to the
+// score.
+type MatchedRule struct {
+	Name       string  `json:"name"`
+	ThreatType string  `json:"threat_type"`
+	Weight     float64 `json:"weight"`
+}
+
+type scoringRule struct {
+	name       string
+	threatType string
+	weight     float64
+	match      func(req AnalyzeRequest, cfg ScoringConfig) bool
+}
+
+// defaultScoringRules are the built-in rules, used when the scoring_rules
+// table is empty or unavailable. They read their thresholds from cfg.
+var defaultScoringRules = []scoringRule{
+	{
+		// Packet flood: high packet rate over the flow's lifetime.
+		name:       "packet-flood",
+		threatType: "DoS",
+		weight:     0.6,
+		match: func(req AnalyzeRequest, cfg ScoringConfig) bool {
+			return float64(*req.PacketCount)/math.Max(durationOf(req), 1) >= cfg.DoSPacketRate
+		},
+	},
+	{
+		// Probe: a handful of tiny packets, typical of port scans.
+		name:       "port-probe",
+		threatType: "Probe",
+		weight:     0.4,
+		match: func(req AnalyzeRequest, cfg ScoringConfig) bool {
+			return *req.PacketCount <= 3 && *req.Bytes < 100
+		},
+	},
+	{
+		// Remote access attempt against an administrative service.
+		name:       "remote-access-port",
+		threatType: "R2L",
+		weight:     0.3,
+		match: func(req AnalyzeRequest, cfg ScoringConfig) bool {
+			return sensitivePorts[*req.DestPort]
+		},
+	},
+	{
+		// Unusually large single transfer.
+		name:       "large-transfer",
+		threatType: "R2L",
+		weight:     0.3,
+		match: func(req AnalyzeRequest, cfg ScoringConfig) bool {
+			return *req.Bytes >= cfg.LargeTransferBytes
+		},
+	},
+}
+
+// normalizeIPs rewrites source_ip and dest_ip in the canonical form the
+// ingestion service stores, so a sample analyzed here groups with ingested
+// traffic from the same address in threats, feedback and source stats.
+func (r *AnalyzeRequest) normalizeIPs() {
+	r.SourceIP = canonicalIP(r.SourceIP)
+	if r.DestIP != "" {
+		r.DestIP = canonicalIP(r.DestIP)
+	}
+}
+
+// canonicalIP prints IPv4-mapped IPv6 addresses as plain IPv4 and IPv6 in its
+// shortest lower-case notation (RFC 5952). s is returned unchanged if it isn't
+// an address; the binding has already rejected those.
+func canonicalIP(s string) string {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return s
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.String()
+	}
+	return ip.String()
+}
+
+func durationOf(req AnalyzeRequest) float64 {
+	if req.Duration == nil {
+		return 0
+	}
+	return *req.Duration
+}
+
+// scoreTraffic sums the weights of every matching rule (capped at 1) and maps
+// the score to a label. The threat type comes from the heaviest matching rule.
+// A sample no rule matched gets cfg.UnmatchedLabel; one that matched but
+// scored below the suspicious threshold is benign.
+func scoreTraffic(req AnalyzeRequest, cfg ScoringConfig, rules []scoringRule) Verdict {
+	var score, topWeight float64
+	var threatType string
+	matched := []MatchedRule{}
+	for _, rule := range rules {
+		if !rule.match(req, cfg) {
+			continue
+		}
+		matched = append(matched, MatchedRule{Name: rule.name, ThreatType: rule.threatType, Weight: rule.weight})
+		score += rule.weight
+		if rule.weight > topWeight {
+			topWeight = rule.weight
+			threatType = rule.threatType
+		}
+	}
+	score = math.Min(score, 1)
+
+	v := Verdict{Score: math.Round(score*1000) / 1000, Label: labelForScore(score, len(matched) > 0, cfg), MatchedRules: matched}
+	if v.isThreat() {
+		v.ThreatType = &threatType
+	}
+	return v
+}
+
+// labelForScore maps a score to a label as described at scoreTraffic.
+func labelForScore(score float64, matched bool, cfg ScoringConfig) string {
+	switch {
+	case !matched:
+		return cfg.UnmatchedLabel
+	case score >= cfg.MaliciousThreshold:
+		return "malicious"
+	case score >= cfg.SuspiciousThreshold:
+		return "suspicious"
+	}
+	return "benign"
+}
+
+func analyzeTraffic(c *gin.Context) {
+	var req AnalyzeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+		return
+	}
+	req.normalizeIPs()
+
+	verdict, feedbackWeight, ok := scoreInPool(c, req)
+	if !ok {
+		return
+	}
+	tenant := tenantFromContext(c)
+
+	ctx := c.Request.Context()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		requestLog(c).Error("Failed to begin analysis transaction", "error", err)
+		internalError(c, "failed to persist analysis")
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := persistAnalysis(c, tx, tenant, req, verdict)
+	if err != nil {
+		requestLog(c).Error("Failed to persist analysis", "error", err)
+		internalError(c, "failed to persist analysis")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		requestLog(c).Error("Failed to commit analysis", "error", err)
+		internalError(c, "failed to persist analysis")
+		return
+	}
+	publishAnalysis(c, result)
+	invalidateStats(c, tenant)
+
+	respond(c, 201, result.threat, gin.H{
+		"score":           verdict.Score,
+		"label":           verdict.Label,
+		"threat_type":     verdict.ThreatType,
+		"matched_rules":   verdict.MatchedRules,
+		"feedback_weight": feedbackWeight,
+		"alert":           result.alert,
+		"correlated":      result.correlated,
+		"snoozed":         result.snoozed,
+	})
+}
+
+// analysisResult is what persistAnalysis stored for one scored sample.
+type analysisResult struct {
+	threat     Threat
+	alert      *Alert // nil unless the verdict is a threat
+	correlated bool   // alert is an open one the sample was folded into
+	snoozed    bool   // alert was created already acknowledged
+}
+
+// persistAnalysis stores the traffic sample and its threat in tx and, for a
+// threat verdict, folds it into an open alert or raises a new one.
+func persistAnalysis(c *gin.Context, tx *sql.Tx, tenant string, req AnalyzeRequest, verdict Verdict) (analysisResult, error) {
+	ctx := c.Request.Context()
+	var result analysisResult
+
+	var destIP *string
+	if req.DestIP != "" {
+		destIP = &req.DestIP
+	}
+
+	geo := lookupGeo(req.SourceIP)
+	var trafficID string
+	err := tx.QueryRowContext(ctx, `INSERT INTO traffic (tenant_id, source_ip, dest_ip, source_port, dest_port, protocol, bytes, packet_count, duration,
+			country, city, asn, as_org)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id`,
+		tenant, req.SourceIP, destIP, req.SourcePort, *req.DestPort, req.Protocol, *req.Bytes, *req.PacketCount, durationOf(req),
+		geo.Country, geo.City, geo.ASN, geo.ASOrg,
+	).Scan(&trafficID)
+	if err != nil {
+		return result, fmt.Errorf("insert traffic sample: %w", err)
+	}
+
+	result.threat, err = scanThreat(tx.QueryRowContext(ctx, `INSERT INTO threats (tenant_id, traffic_id, source_ip, threat_type, label, confidence)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING `+threatColumns,
+		tenant, trafficID, req.SourceIP, verdict.ThreatType, verdict.Label, verdict.Score,
+	))
+	if err != nil {
+		return result, fmt.Errorf("insert threat: %w", err)
+	}
+	if !verdict.isThreat() {
+		return result, nil
+	}
+
+	// Repeat detections of an open alert's source and threat type are folded
+	// into it rather than raising a new one.
+	result.alert, err = correlateAlert(ctx, tx, tenant, req.SourceIP, *verdict.ThreatType)
+	if err != nil {
+		return result, fmt.Errorf("correlate alert: %w", err)
+	}
+	if result.correlated = result.alert != nil; result.correlated {
+		return result, nil
+	}
+
+	// Alerts from a snoozed source are still recorded, but already
+	// acknowledged so they stay out of the triage queue.
+	var status, acknowledgedBy interface{} = "new", nil
+	if result.snoozed = isSourceSnoozed(c, tenant, req.SourceIP); result.snoozed {
+		status, acknowledgedBy = "acknowledged", snoozeActor
+	}
+	created, err := scanAlert(tx.QueryRowContext(ctx, `INSERT INTO alerts (tenant_id, threat_id, severity, description, source_ip, destination_ip,
+			status, acknowledged_by, acknowledged_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8::text, CASE WHEN $8::text IS NULL THEN NULL ELSE LOCALTIMESTAMP END) RETURNING `+alertColumns,
+		tenant, result.threat.ID, severityForScore(verdict.Score, scoringConfig),
+		fmt.Sprintf("%s traffic from %s (score %.2f)", *verdict.ThreatType, req.SourceIP, verdict.Score),
+		req.SourceIP, destIP, status, acknowledgedBy,
+	))
+	if err != nil {
+		return result, fmt.Errorf("insert alert: %w", err)
+	}
+	created.IncidentID, err = groupAlertIntoIncident(ctx, tx, tenant, created)
+	if err != nil {
+		return result, fmt.Errorf("group alert %s into incident: %w", created.ID, err)
+	}
+	result.alert = &created
+	return result, nil
+}
+
+// publishAnalysis announces a newly raised alert once its transaction has
+// committed. The database is the source of truth, so a Redis failure is
+// logged but doesn't fail the request. Correlated repeats aren't published
+// again, and snoozed alerts not at all.
+func publishAnalysis(c *gin.Context, result analysisResult) {
+	if result.alert == nil || result.correlated || result.snoozed {
+		return
+	}
+	ctx := c.Request.Context()
+	if err := publishAlert(ctx, *result.alert); err != nil {
+		requestLog(c).Warn("Failed to publish alert event", "alert_id", result.alert.ID, "error", err)
+	}
+	if err := enqueueAlertWebhooks(ctx, *result.alert); err != nil {
+		requestLog(c).Warn("Failed to queue alert webhooks", "alert_id", result.alert.ID, "error", err)
+	}
+}
+
+// scoreInPool scores req on analyzePool and applies false-positive feedback,
+// returning the verdict and the feedback weight applied to it. When scoring
+// isn't possible it writes the error response and returns false.
+func scoreInPool(c *gin.Context, req AnalyzeRequest) (Verdict, float64, bool) {
+	verdicts, weights, ok := scoreAllInPool(c, []AnalyzeRequest{req})
+	if !ok {
+		return Verdict{}, 0, false
+	}
+	return verdicts[0], weights[0], true
+}
+
+// scoreAllInPool is scoreInPool for several samples, scored in order as one
+// job so a batch takes a single worker.
+func scoreAllInPool(c *gin.Context, reqs []AnalyzeRequest) ([]Verdict, []float64, bool) {
+	rules := activeScoringRules(c)
+	verdicts := make([]Verdict, len(reqs))
+	err := analyzePool.run(c.Request.Context(), analyzeQueueTimeout, func() {
+		for i, req := range reqs {
+			verdicts[i] = scoreTraffic(req, scoringConfig, rules)
+		}
+	})
+	if errors.Is(err, errPoolBusy) {
+		c.Header("Retry-After", "1")
+		c.JSON(503, gin.H{"error": "analysis capacity exhausted, retry shortly"})
+		return nil, nil, false
+	}
+	if err != nil {
+		internalError(c, "failed to analyze traffic")
+		return nil, nil, false
+	}
+	return verdicts, applyFeedback(c, reqs, verdicts), true
+}
+
+// severityForScore maps a threat score to an alert severity by the
+// ANALYZE_SEVERITY_* boundaries in cfg. A score exactly on a boundary takes
+// the higher severity.
+func severityForScore(score float64, cfg ScoringConfig) string {
+	switch {
+	case score >= cfg.SeverityCritical:
+		return "critical"
+	case score >= cfg.SeverityHigh:
+		return "high"
+	case score >= cfg.SeverityMedium:
+		return "medium"
+	default:
+		return "low"
+	}
+}
+
+// publishAlert sends the full alert on alertsChannel so subscribers don't
+// need a database round trip.
+func publishAlert(ctx context.Context, alert Alert) error {
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	return redisClient.Publish(ctx, alertsChannel, payload).Err()
+}
+
+// reanalyzeThreat re-scores a stored threat against the current scoring rules
+// and false-positive feedback using the traffic sample it was created from,
+// updating its label and score in place and recording the change in
+// threat_audit. Related alerts are left as they are. The sample is scored
+// before the threat is locked, so waiting for a worker holds no row lock.
+func reanalyzeThreat(c *gin.Context) {
+	id := c.Param("id")
+	if !isValidUUID(id) {
+		c.JSON(400, gin.H{"error": "invalid threat id"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	tenant := tenantFromContext(c)
+	var trafficID *string
+	err := db.QueryRowContext(ctx, "SELECT traffic_id FROM threats WHERE id = $1 AND tenant_id = $2", id, tenant).Scan(&trafficID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"error": "threat not found"})
+		return
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to fetch threat", "threat_id", id, "error", err)
+		internalError(c, "failed to reanalyze threat")
+		return
+	}
+	if trafficID == nil {
+		c.JSON(404, gin.H{"error": "source traffic for threat not found"})
+		return
+	}
+
+	req, err := scanTrafficSample(db.QueryRowContext(ctx, "SELECT "+trafficSampleColumns+" FROM traffic WHERE id = $1", *trafficID))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"error": "source traffic for threat not found"})
+		return
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to load traffic for threat", "threat_id", id, "error", err)
+		internalError(c, "failed to reanalyze threat")
+		return
+	}
+	after, _, ok := scoreInPool(c, req)
+	if !ok {
+		return
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		requestLog(c).Error("Failed to begin reanalysis transaction", "threat_id", id, "error", err)
+		internalError(c, "failed to reanalyze threat")
+		return
+	}
+	defer tx.Rollback()
+
+	var before Verdict
+	err = tx.QueryRowContext(ctx, "SELECT confidence, label, threat_type FROM threats WHERE id = $1 AND tenant_id = $2 FOR UPDATE",
+		id, tenant).Scan(&before.Score, &before.Label, &before.ThreatType)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"error": "threat not found"})
+		return
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to lock threat", "threat_id", id, "error", err)
+		internalError(c, "failed to reanalyze threat")
+		return
+	}
+
+	threat, err := scanThreat(tx.QueryRowContext(ctx, "UPDATE threats SET threat_type = $1, label = $2, confidence = $3 WHERE id = $4 RETURNING "+threatColumns,
+		after.ThreatType, after.Label, after.Score, id))
+	if err != nil {
+		requestLog(c).Error("Failed to update threat", "threat_id", id, "error", err)
+		internalError(c, "failed to reanalyze threat")
+		return
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO threat_audit
+		(threat_id, action, old_label, new_label, old_threat_type, new_threat_type, old_confidence, new_confidence, changed_by)
+		VALUES ($1, 'reanalysis', $2, $3, $4, $5, $6, $7, $8)`,
+		id, before.Label, after.Label, before.ThreatType, after.ThreatType, before.Score, after.Score, actorFromContext(c))
+	if err != nil {
+		requestLog(c).Error("Failed to write audit record for threat", "threat_id", id, "error", err)
+		internalError(c, "failed to reanalyze threat")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		requestLog(c).Error("Failed to commit reanalysis", "threat_id", id, "error", err)
+		internalError(c, "failed to reanalyze threat")
+		return
+	}
+
+	respond(c, 200, threat, gin.H{"before": before, "after": after, "matched_rules": after.MatchedRules})
+}
+
+// trafficSampleColumns are the traffic columns scanTrafficSample reads.
+const trafficSampleColumns = "source_ip, dest_ip, source_port, dest_port, protocol, bytes, packet_count, duration"
+
+// scanTrafficSample reads a stored traffic row, selected with
+// trafficSampleColumns followed by any extra columns, back into the request
+// it would have been scored from.
+func scanTrafficSample(s rowScanner, extra ...interface{}) (AnalyzeRequest, error) {
+	var req AnalyzeRequest
+	var destIP *string
+	var destPort *int
+	var bytes, packets int64
+	var duration float64
+	dest := append([]interface{}{&req.SourceIP, &destIP, &req.SourcePort, &destPort, &req.Protocol, &bytes, &packets, &duration}, extra...)
+	if err := s.Scan(dest...); err != nil {
+		return req, err
+	}
+	if destIP != nil {
+		req.DestIP = *destIP
+	}
+	if destPort == nil {
+		destPort = new(int)
+	}
+	req.DestPort, req.Bytes, req.PacketCount, req.Duration = destPort, &bytes, &packets, &duration
+	return req, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// maxAnalyzeBatch bounds how many samples one POST /analyze/batch scores. Set
+// by ANALYZE_BATCH_MAX_SAMPLES.
+var maxAnalyzeBatch = 500
+
+// BatchVerdict is the outcome for one sample of a batch, at the same index as
+// the sample. Samples that failed to decode or validate carry only Error.
+type BatchVerdict struct {
+	Index          int           `json:"index"`
+	Error          string        `json:"error,omitempty"`
+	Score          float64       `json:"score"`
+	Label          string        `json:"label"`
+	ThreatType     *string       `json:"threat_type"`
+	MatchedRules   []MatchedRule `json:"matched_rules"`
+	FeedbackWeight float64       `json:"feedback_weight"`
+	Threat         *Threat       `json:"threat,omitempty"`
+	Alert          *Alert        `json:"alert"`
+	Correlated     bool          `json:"correlated"`
+	Snoozed        bool          `json:"snoozed"`
+}
+
+// analyzeTrafficBatch scores an array of samples like analyzeTraffic and
+// persists all of them in one transaction. Malformed samples are reported at
+// their index instead of failing the batch; a database error still fails it
+// as a whole, so either every valid sample is stored or none is.
+func analyzeTrafficBatch(c *gin.Context) {
+	var raw []json.RawMessage
+	if err := c.ShouldBindJSON(&raw); err != nil {
+		c.JSON(400, gin.H{"error": "invalid request body: expected a JSON array of traffic samples"})
+		return
+	}
+	if len(raw) == 0 {
+		c.JSON(400, gin.H{"error": "batch is empty"})
+		return
+	}
+	if len(raw) > maxAnalyzeBatch {
+		c.JSON(413, gin.H{"error": fmt.Sprintf("batch of %d samples exceeds the maximum of %d", len(raw), maxAnalyzeBatch)})
+		return
+	}
+
+	results := make([]BatchVerdict, len(raw))
+	reqs := make([]AnalyzeRequest, 0, len(raw))
+	indexes := make([]int, 0, len(raw)) // position of each valid sample in raw
+	for i, item := range raw {
+		results[i].Index = i
+		var req AnalyzeRequest
+		err := json.Unmarshal(item, &req)
+		if err == nil {
+			err = binding.Validator.ValidateStruct(&req)
+		}
+		if err != nil {
+			results[i].Error = "invalid sample: " + err.Error()
+			continue
+		}
+		req.normalizeIPs()
+		reqs = append(reqs, req)
+		indexes = append(indexes, i)
+	}
+	if len(reqs) == 0 {
+		respond(c, 200, results, gin.H{"analyzed": 0, "failed": len(raw)})
+		return
+	}
+
+	verdicts, weights, ok := scoreAllInPool(c, reqs)
+	if !ok {
+		return
+	}
+	tenant := tenantFromContext(c)
+
+	ctx := c.Request.Context()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		requestLog(c).Error("Failed to begin batch analysis transaction", "error", err)
+		internalError(c, "failed to persist analysis")
+		return
+	}
+	defer tx.Rollback()
+
+	stored := make([]analysisResult, len(reqs))
+	for j, req := range reqs {
+		verdict, weight := verdicts[j], weights[j]
+		stored[j], err = persistAnalysis(c, tx, tenant, req, verdict)
+		if err != nil {
+			requestLog(c).Error("Failed to persist batch analysis", "index", indexes[j], "error", err)
+			internalError(c, "failed to persist analysis")
+			return
+		}
+		threat := stored[j].threat
+		results[indexes[j]] = BatchVerdict{
+			Index:          indexes[j],
+			Score:          verdict.Score,
+			Label:          verdict.Label,
+			ThreatType:     verdict.ThreatType,
+			MatchedRules:   verdict.MatchedRules,
+			FeedbackWeight: weight,
+			Threat:         &threat,
+			Alert:          stored[j].alert,
+			Correlated:     stored[j].correlated,
+			Snoozed:        stored[j].snoozed,
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		requestLog(c).Error("Failed to commit batch analysis", "error", err)
+		internalError(c, "failed to persist analysis")
+		return
+	}
+	for _, result := range stored {
+		publishAnalysis(c, result)
+	}
+	invalidateStats(c, tenant)
+
+	respond(c, 200, results, gin.H{"analyzed": len(reqs), "failed": len(raw) - len(reqs)})
+}
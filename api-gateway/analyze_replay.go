@@ -0,0 +1,211 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// maxReplayRows bounds how many traffic rows one replay scores. Set by
+// ANALYZE_REPLAY_MAX_ROWS.
+var maxReplayRows = 100000
+
+// unscoredLabel stands in for the verdict of traffic that has no threat row,
+// e.g. records ingested but never analyzed.
+const unscoredLabel = "unscored"
+
+// ReplayReport summarizes how the current scoring rules judge stored traffic
+// compared to the verdicts recorded for it.
+type ReplayReport struct {
+	Scanned         int            `json:"scanned"`
+	Truncated       bool           `json:"truncated"`
+	Changed         int            `json:"changed"`
+	NewlyFlagged    int            `json:"newly_flagged"`
+	NoLongerFlagged int            `json:"no_longer_flagged"`
+	Before          map[string]int `json:"before"`
+	After           map[string]int `json:"after"`
+	Committed       bool           `json:"committed"`
+	Updated         int            `json:"updated"`
+}
+
+// replayUpdate is a stored threat whose verdict changed under the current
+// rules.
+type replayUpdate struct {
+	threatID string
+	verdict  Verdict
+}
+
+// replayTraffic scores the tenant's traffic received since ?since= with the
+// current rules, thresholds and false-positive feedback and reports how the
+// verdicts would change. It is a dry run unless ?commit=true, which rewrites
+// the label, type and score of the threats whose verdict changed, like
+// reanalyzeThreat does for one. Alerts are never touched and traffic without
+// a threat gets none.
+func replayTraffic(c *gin.Context) {
+	if c.Query("since") == "" {
+		c.JSON(400, gin.H{"error": "since is required, e.g. since=2024-01-01T00:00:00Z"})
+		return
+	}
+	since, err := parseSince(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	commit := c.Query("commit") == "true"
+
+	ctx := c.Request.Context()
+	tenant := tenantFromContext(c)
+	rules := activeScoringRules(c)
+	// Unlike a single analysis, a replay that can't read the feedback fails:
+	// committing it would undo the down-weighting of every marked signature.
+	feedback, err := loadFeedback(ctx, tenant, nil)
+	if err != nil {
+		requestLog(c).Error("Failed to load false-positive feedback for replay", "error", err)
+		internalError(c, "failed to replay traffic")
+		return
+	}
+
+	// Rows are scored as they are read, so memory only grows with the number
+	// of changed verdicts.
+	rows, err := db.QueryContext(ctx, `SELECT t.source_ip, t.dest_ip, t.source_port, t.dest_port, t.protocol, t.bytes, t.packet_count, t.duration,
+			th.id, th.label, th.threat_type, th.confidence
+		FROM traffic t
+		LEFT JOIN threats th ON th.traffic_id = t.id AND th.tenant_id = t.tenant_id
+		WHERE t.tenant_id = $1 AND t.received_at >= $2
+		ORDER BY t.received_at ASC
+		LIMIT $3`, tenant, since, maxReplayRows+1)
+	if err != nil {
+		requestLog(c).Error("Failed to query traffic for replay", "error", err)
+		internalError(c, "failed to replay traffic")
+		return
+	}
+	defer rows.Close()
+
+	report := ReplayReport{Before: map[string]int{}, After: map[string]int{}}
+	var updates []replayUpdate
+	for rows.Next() {
+		if report.Scanned == maxReplayRows {
+			report.Truncated = true
+			break
+		}
+		var threatID, label, threatType sql.NullString
+		var score sql.NullFloat64
+		req, err := scanTrafficSample(rows, &threatID, &label, &threatType, &score)
+		if err != nil {
+			requestLog(c).Error("Failed to scan traffic for replay", "error", err)
+			internalError(c, "failed to replay traffic")
+			return
+		}
+		report.Scanned++
+
+		before := Verdict{Label: unscoredLabel}
+		if threatID.Valid {
+			before = Verdict{Label: label.String, Score: score.Float64}
+			if threatType.Valid {
+				before.ThreatType = &threatType.String
+			}
+		}
+		after, _ := feedback.apply(req, scoreTraffic(req, scoringConfig, rules))
+		report.Before[before.Label]++
+		report.After[after.Label]++
+
+		if !verdictChanged(before, after) {
+			continue
+		}
+		report.Changed++
+		switch {
+		case after.isThreat() && !before.isThreat():
+			report.NewlyFlagged++
+		case before.isThreat() && !after.isThreat():
+			report.NoLongerFlagged++
+		}
+		if commit && threatID.Valid {
+			updates = append(updates, replayUpdate{threatID: threatID.String, verdict: after})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(c).Error("Failed to iterate traffic for replay", "error", err)
+		internalError(c, "failed to replay traffic")
+		return
+	}
+	rows.Close()
+
+	if commit {
+		n, err := applyReplayUpdates(c, tenant, updates)
+		if err != nil {
+			requestLog(c).Error("Failed to update replayed threats", "error", err)
+			internalError(c, "failed to update replayed threats")
+			return
+		}
+		report.Committed, report.Updated = true, n
+		requestLog(c).Info("Committed traffic replay", "tenant_id", tenant, "actor", actorFromContext(c), "since", since, "updated", n)
+		recordAdminAction(c, "analyze_replay", nil, gin.H{"since": since, "updated": n})
+	}
+
+	respond(c, 200, report, nil)
+}
+
+// verdictChanged reports whether re-scoring changed the label or threat type.
+// Score alone drifting within the same label doesn't count.
+func verdictChanged(before, after Verdict) bool {
+	if before.Label != after.Label {
+		return true
+	}
+	if before.ThreatType == nil || after.ThreatType == nil {
+		return (before.ThreatType == nil) != (after.ThreatType == nil)
+	}
+	return *before.ThreatType != *after.ThreatType
+}
+
+// applyReplayUpdates writes the new verdicts, and their threat_audit records,
+// in one transaction, a chunk of rows per statement.
+func applyReplayUpdates(c *gin.Context, tenant string, updates []replayUpdate) (int, error) {
+	const chunk = 1000
+	ctx := c.Request.Context()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	updated := 0
+	for start := 0; start < len(updates); start += chunk {
+		part := updates[start:min(start+chunk, len(updates))]
+		ids := make([]string, len(part))
+		labels := make([]string, len(part))
+		types := make([]sql.NullString, len(part))
+		scores := make([]float64, len(part))
+		for i, u := range part {
+			ids[i], labels[i], scores[i] = u.threatID, u.verdict.Label, u.verdict.Score
+			if u.verdict.ThreatType != nil {
+				types[i] = sql.NullString{String: *u.verdict.ThreatType, Valid: true}
+			}
+		}
+		// The CTEs all see the rows as they were before the UPDATE, so old
+		// holds the previous verdicts for threat_audit.
+		res, err := tx.ExecContext(ctx, `WITH v AS (
+				SELECT * FROM unnest($1::uuid[], $2::text[], $3::text[], $4::float8[]) AS v(id, label, threat_type, confidence)
+			), old AS (
+				SELECT th.id, th.label, th.threat_type, th.confidence FROM threats th JOIN v ON v.id = th.id WHERE th.tenant_id = $5
+			), updated AS (
+				UPDATE threats th
+				SET label = v.label, threat_type = v.threat_type, confidence = v.confidence
+				FROM v
+				WHERE th.id = v.id AND th.tenant_id = $5
+				RETURNING th.id, v.label, v.threat_type, v.confidence
+			)
+			INSERT INTO threat_audit
+				(threat_id, action, old_label, new_label, old_threat_type, new_threat_type, old_confidence, new_confidence, changed_by)
+			SELECT old.id, 'replay', old.label, updated.label, old.threat_type, updated.threat_type, old.confidence, updated.confidence, $6
+			FROM old JOIN updated ON updated.id = old.id`,
+			pq.Array(ids), pq.Array(labels), pq.Array(types), pq.Array(scores), tenant, actorFromContext(c))
+		if err != nil {
+			return updated, fmt.Errorf("after %d rows: %w", updated, err)
+		}
+		n, _ := res.RowsAffected()
+		updated += int(n)
+	}
+	return updated, tx.Commit()
+}
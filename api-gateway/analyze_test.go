@@ -0,0 +1,82 @@
+package main
+
+import "testing"
+
+func TestSeverityForScore(t *testing.T) {
+	saved := scoringConfig
+	t.Cleanup(func() { scoringConfig = saved })
+	t.Setenv("ANALYZE_SEVERITY_MEDIUM", "")
+	t.Setenv("ANALYZE_SEVERITY_HIGH", "")
+	t.Setenv("ANALYZE_SEVERITY_CRITICAL", "")
+	loadScoringConfig()
+
+	tests := []struct {
+		score float64
+		want  string
+	}{
+		{0, "low"},
+		{0.499, "low"},
+		{0.5, "medium"},
+		{0.699, "medium"},
+		{0.7, "high"},
+		{0.899, "high"},
+		{0.9, "critical"},
+		{1, "critical"},
+	}
+	for _, tt := range tests {
+		if got := severityForScore(tt.score, scoringConfig); got != tt.want {
+			t.Errorf("severityForScore(%g) = %q, want %q", tt.score, got, tt.want)
+		}
+	}
+}
+
+func TestLoadScoringConfigSeverityBoundaries(t *testing.T) {
+	saved := scoringConfig
+	t.Cleanup(func() { scoringConfig = saved })
+
+	tests := []struct {
+		name                   string
+		medium, high, critical string
+		want                   [3]float64
+	}{
+		{"defaults", "", "", "", [3]float64{0.5, 0.7, 0.9}},
+		{"custom", "0.3", "0.6", "0.85", [3]float64{0.3, 0.6, 0.85}},
+		{"equal boundaries", "0.5", "0.5", "0.9", [3]float64{0.5, 0.5, 0.9}},
+		{"descending", "0.9", "0.7", "0.5", [3]float64{0.5, 0.7, 0.9}},
+		{"high below medium", "0.6", "0.4", "0.9", [3]float64{0.5, 0.7, 0.9}},
+		{"critical below high", "0.3", "0.8", "0.7", [3]float64{0.5, 0.7, 0.9}},
+		{"negative", "-0.1", "0.7", "0.9", [3]float64{0.5, 0.7, 0.9}},
+		{"above 1", "0.5", "0.7", "1.5", [3]float64{0.5, 0.7, 0.9}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ANALYZE_SEVERITY_MEDIUM", tt.medium)
+			t.Setenv("ANALYZE_SEVERITY_HIGH", tt.high)
+			t.Setenv("ANALYZE_SEVERITY_CRITICAL", tt.critical)
+			loadScoringConfig()
+			got := [3]float64{scoringConfig.SeverityMedium, scoringConfig.SeverityHigh, scoringConfig.SeverityCritical}
+			if got != tt.want {
+				t.Errorf("boundaries = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyzeRequestNormalizeIPs(t *testing.T) {
+	tests := []struct {
+		source, dest         string
+		wantSource, wantDest string
+	}{
+		{"10.0.0.1", "", "10.0.0.1", ""},
+		{"::ffff:10.0.0.1", "::FFFF:192.168.1.1", "10.0.0.1", "192.168.1.1"},
+		{"2001:DB8:0:0:0:0:0:1", "2001:0db8::0001", "2001:db8::1", "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		req := AnalyzeRequest{SourceIP: tt.source, DestIP: tt.dest}
+		req.normalizeIPs()
+		if req.SourceIP != tt.wantSource || req.DestIP != tt.wantDest {
+			t.Errorf("normalizeIPs(%q, %q) = %q, %q, want %q, %q",
+				tt.source, tt.dest, req.SourceIP, req.DestIP, tt.wantSource, tt.wantDest)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordAdminAction writes an admin_audit row for an admin endpoint that
+// changed something. The change has already happened, so a failure is logged
+// rather than failing the request.
+func recordAdminAction(c *gin.Context, action string, target *string, details gin.H) {
+	payload, err := json.Marshal(details)
+	if err != nil {
+		payload = []byte("{}")
+	}
+	_, err = db.ExecContext(c.Request.Context(), `INSERT INTO admin_audit (tenant_id, action, target, details, actor)
+		VALUES ($1, $2, $3, $4, $5)`, tenantFromContext(c), action, target, payload, actorFromContext(c))
+	if err != nil {
+		requestLog(c).Error("Failed to record admin action", "action", action, "error", err)
+	}
+}
+
+// AuditRecord is one line of the audit export: an alert_audit row (Kind
+// "alert", Target is the alert id) or an admin_audit row (Kind "admin").
+// Details holds the action-specific fields, such as old and new status.
+type AuditRecord struct {
+	Kind    string          `json:"kind"`
+	ID      string          `json:"id"`
+	Action  string          `json:"action"`
+	Actor   string          `json:"actor"`
+	At      time.Time       `json:"at"`
+	Target  *string         `json:"target"`
+	Details json.RawMessage `json:"details"`
+}
+
+// parseTimeRange reads the optional RFC3339 ?since= and ?until= bounds of an
+// audit export. Unlike parseSince there is no limit on how far back they go.
+func parseTimeRange(c *gin.Context) (since, until *time.Time, err error) {
+	parse := func(name string) (*time.Time, error) {
+		v := c.Query(name)
+		if v == "" {
+			return nil, nil
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: must be an RFC3339 timestamp", name, v)
+		}
+		// Columns are TIMESTAMP without time zone and written in UTC.
+		t = t.UTC()
+		return &t, nil
+	}
+	if since, err = parse("since"); err != nil {
+		return nil, nil, err
+	}
+	if until, err = parse("until"); err != nil {
+		return nil, nil, err
+	}
+	if since != nil && until != nil && !until.After(*since) {
+		return nil, nil, fmt.Errorf("until must be after since")
+	}
+	return since, until, nil
+}
+
+// exportAudit streams the tenant's alert audit history and admin actions in
+// [since, until) as newline-delimited JSON, oldest first. Rows are written as
+// they are read from the cursor, so memory use doesn't grow with the export.
+func exportAudit(c *gin.Context) {
+	since, until, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := readDB().QueryContext(c.Request.Context(), `SELECT kind, id, action, actor, at, target, details FROM (
+			SELECT 'alert' AS kind, aa.id, aa.action, aa.changed_by AS actor, aa.changed_at AS at, aa.alert_id::text AS target,
+				jsonb_strip_nulls(jsonb_build_object(
+					'old_status', aa.old_status, 'new_status', aa.new_status,
+					'old_severity', aa.old_severity, 'new_severity', aa.new_severity,
+					'old_assignee', aa.old_assignee, 'new_assignee', aa.new_assignee)) AS details
+			FROM alert_audit aa
+			JOIN alerts a ON a.id = aa.alert_id
+			WHERE a.tenant_id = $1
+				AND ($2::timestamp IS NULL OR aa.changed_at >= $2) AND ($3::timestamp IS NULL OR aa.changed_at < $3)
+			UNION ALL
+			SELECT 'admin', id, action, actor, created_at, target, details
+			FROM admin_audit
+			WHERE tenant_id = $1
+				AND ($2::timestamp IS NULL OR created_at >= $2) AND ($3::timestamp IS NULL OR created_at < $3)
+		) audit
+		ORDER BY at ASC, id ASC`, tenantFromContext(c), since, until)
+	if err != nil {
+		requestLog(c).Error("Failed to query audit records for export", "error", err)
+		internalError(c, "failed to export audit records")
+		return
+	}
+	defer rows.Close()
+
+	filename := "audit-" + time.Now().UTC().Format("20060102-150405") + ".jsonl"
+	c.Header("Content-Disposition", "attachment; filename=\""+filename+"\"")
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(200)
+
+	// Once streaming has started the status is already sent, so failures can
+	// only be logged and the response cut short.
+	enc := json.NewEncoder(c.Writer)
+	var n int
+	for rows.Next() {
+		var r AuditRecord
+		var details []byte
+		if err := rows.Scan(&r.Kind, &r.ID, &r.Action, &r.Actor, &r.At, &r.Target, &details); err != nil {
+			requestLog(c).Error("Failed to scan audit record during export", "error", err)
+			return
+		}
+		r.Details = details
+		if err := enc.Encode(r); err != nil {
+			requestLog(c).Warn("Audit export aborted", "rows", n, "error", err)
+			return
+		}
+		n++
+		if n%exportFlushEvery == 0 {
+			c.Writer.Flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(c).Error("Failed to iterate audit records during export", "rows", n, "error", err)
+		return
+	}
+	c.Writer.Flush()
+}
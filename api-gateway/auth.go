@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+)
+
+// APIKey is the authenticated identity attached to the request context.
+type APIKey struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	TenantID string   `json:"tenant_id"`
+	Scopes   []string `json:"scopes"`
+}
+
+// defaultTenantID is the tenant of keys and tokens that don't name one; it
+// matches the column default in database/schema.sql.
+const defaultTenantID = "default"
+
+// apiKeyCacheTTL bounds how long a key lookup (including a miss) is served
+// from Redis, and therefore how long a revoked key may keep working.
+var apiKeyCacheTTL = 5 * time.Minute
+
+// hashAPIKey returns the value stored in api_keys.key_hash for key.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func apiKeyAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authenticateAPIKey(c) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// authenticateAPIKey validates the X-API-Key header and attaches the key's
+// identity and scopes to the context. On failure it writes the error response,
+// aborts, and returns false.
+func authenticateAPIKey(c *gin.Context) bool {
+	apiKey := c.GetHeader("X-API-Key")
+	if apiKey == "" {
+		c.JSON(401, gin.H{"error": "Unauthorized - Invalid or missing API key"})
+		c.Abort()
+		return false
+	}
+
+	key, err := lookupAPIKey(c, hashAPIKey(apiKey))
+	if err != nil {
+		requestLog(c).Error("Failed to look up API key", "error", err)
+		internalError(c, "failed to authenticate request")
+		c.Abort()
+		return false
+	}
+	if key == nil {
+		c.JSON(401, gin.H{"error": "Unauthorized - Invalid or missing API key"})
+		c.Abort()
+		return false
+	}
+
+	c.Set("api_key", key)
+	c.Set("scopes", key.Scopes)
+	c.Set("tenant_id", key.TenantID)
+	c.Set("actor", "api-key:"+key.Name)
+	recordKeyUsage(c, key.ID)
+	return true
+}
+
+// lookupAPIKey resolves a key hash to an active key, consulting Redis before
+// Postgres. A nil key with a nil error means the key is unknown, inactive or
+// expired; misses are cached too so bad keys can't be used to hammer the DB.
+func lookupAPIKey(c *gin.Context, keyHash string) (*APIKey, error) {
+	ctx := c.Request.Context()
+	cacheKey := "apikey:" + keyHash
+
+	if cached, err := redisClient.Get(ctx, cacheKey).Bytes(); err == nil {
+		if len(cached) == 0 {
+			return nil, nil
+		}
+		var key APIKey
+		if err := json.Unmarshal(cached, &key); err == nil {
+			return &key, nil
+		}
+	} else if err != redis.Nil {
+		requestLog(c).Warn("Failed to read API key cache", "error", err)
+	}
+
+	// A rotated key's previous secret also matches until its grace period
+	// ends; graceEnd is only set in that case.
+	var key APIKey
+	var graceEnd *time.Time
+	err := db.QueryRowContext(ctx, `SELECT id, name, tenant_id, scopes,
+			CASE WHEN key_hash = $1 THEN NULL ELSE previous_key_expires_at END
+		FROM api_keys
+		WHERE (key_hash = $1 OR (previous_key_hash = $1 AND previous_key_expires_at > LOCALTIMESTAMP))
+			AND is_active AND (expires_at IS NULL OR expires_at > LOCALTIMESTAMP)`,
+		keyHash,
+	).Scan(&key.ID, &key.Name, &key.TenantID, pq.Array(&key.Scopes), &graceEnd)
+
+	var payload []byte
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		// Cache the miss as an empty value.
+	case err != nil:
+		return nil, err
+	default:
+		payload, _ = json.Marshal(key)
+	}
+
+	ttl := apiKeyCacheTTL
+	if graceEnd != nil {
+		// Never 0, which Redis would take as no expiry at all.
+		ttl = min(ttl, max(time.Until(*graceEnd), time.Millisecond))
+	}
+	if err := redisClient.Set(ctx, cacheKey, payload, ttl).Err(); err != nil {
+		requestLog(c).Warn("Failed to write API key cache", "error", err)
+	}
+
+	if payload == nil {
+		return nil, nil
+	}
+	return &key, nil
+}
+
+// requireScope rejects requests whose credentials lack scope with a 403. It
+// must run after authMiddleware (or apiKeyAuthMiddleware), which set "scopes"
+// from the API key's scopes or the JWT's roles.
+func requireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !contains(c.GetStringSlice("scopes"), scope) {
+			c.JSON(403, gin.H{"error": "Forbidden - credentials lack the '" + scope + "' scope"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// tenantFromContext returns the tenant attached by the auth middleware. Every
+// query on tenant data filters on it, so an empty value matches nothing
+// rather than everything.
+func tenantFromContext(c *gin.Context) string {
+	return c.GetString("tenant_id")
+}
+
+// actorFromContext returns the identity attached by the auth middleware.
+func actorFromContext(c *gin.Context) string {
+	if actor := c.GetString("actor"); actor != "" {
+		return actor
+	}
+	return "unknown"
+}
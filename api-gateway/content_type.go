@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requireContentType rejects POST, PUT and PATCH requests that carry a body
+// whose Content-Type isn't one of types with a 415, instead of letting them
+// fail later as a vague bind error. Parameters such as charset are ignored,
+// and body-less requests (e.g. POST /alerts/:id/restore) pass.
+func requireContentType(types ...string) gin.HandlerFunc {
+	allowed := make(map[string]bool, len(types))
+	for _, t := range types {
+		allowed[t] = true
+	}
+	want := strings.Join(types, " or ")
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case "POST", "PUT", "PATCH":
+		default:
+			c.Next()
+			return
+		}
+		// ContentLength is -1 for chunked bodies of unknown length
+		if c.Request.ContentLength == 0 || allowed[c.ContentType()] {
+			c.Next()
+			return
+		}
+		c.JSON(415, gin.H{"error": "Content-Type must be " + want})
+		c.Abort()
+	}
+}
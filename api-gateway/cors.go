@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// allowedOrigins is the parsed CORS_ALLOWED_ORIGINS setting. Entries are
+// either exact origins ("https://app.example.com"), wildcard-subdomain
+// patterns ("*.example.com", matched against the origin's host), or "*".
+type allowedOrigins struct {
+	any      bool
+	exact    map[string]bool
+	suffixes []string
+}
+
+// corsOrigins is shared by corsMiddleware and the WebSocket origin check.
+var corsOrigins = parseAllowedOrigins("*")
+
+func parseAllowedOrigins(list string) allowedOrigins {
+	o := allowedOrigins{exact: map[string]bool{}}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case entry == "":
+		case entry == "*":
+			o.any = true
+		case strings.HasPrefix(entry, "*."):
+			o.suffixes = append(o.suffixes, strings.ToLower(entry[1:]))
+		default:
+			o.exact[strings.ToLower(strings.TrimSuffix(entry, "/"))] = true
+		}
+	}
+	return o
+}
+
+// allows reports whether origin is explicitly on the allowlist. The "*"
+// fallback is deliberately not considered here.
+func (o allowedOrigins) allows(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	origin = strings.ToLower(origin)
+	if o.exact[origin] {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	host := u.Hostname()
+	for _, suffix := range o.suffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// corsMiddleware echoes the request's Origin back, with credentials allowed,
+// only when it is on the allowlist. If the list contains "*" other origins
+// get a bare wildcard without credentials, since browsers reject that
+// combination anyway and it would be unsafe if they didn't.
+func corsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h := c.Writer.Header()
+		h.Add("Vary", "Origin")
+
+		origin := c.GetHeader("Origin")
+		switch {
+		case corsOrigins.allows(origin):
+			h.Set("Access-Control-Allow-Origin", origin)
+			h.Set("Access-Control-Allow-Credentials", "true")
+		case corsOrigins.any:
+			h.Set("Access-Control-Allow-Origin", "*")
+		}
+		h.Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-API-Key, If-None-Match, X-Response-Format")
+		h.Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
+		h.Set("Access-Control-Expose-Headers", "Link, ETag, X-Total-Count")
+
+		if c.Request.Method == "OPTIONS" {
+			c.AbortWithStatus(204)
+			return
+		}
+
+		c.Next()
+	}
+}
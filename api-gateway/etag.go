@@ -0,0 +1,45 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondWithETag is respond for a 200 tagged with a hash of the body, or an
+// empty 304 when the request's If-None-Match already lists that tag. Hashing
+// the payload rather than using updated_at also catches changes to embedded
+// rows, such as a threat's alerts.
+func respondWithETag(c *gin.Context, data any, meta gin.H) {
+	payload, err := json.Marshal(envelope(c, data, meta))
+	if err != nil {
+		requestLog(c).Error("Failed to encode response", "error", err)
+		internalError(c, "failed to encode response")
+		return
+	}
+	sum := sha256.Sum256(payload)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, no-cache")
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(304)
+		return
+	}
+	c.Data(200, "application/json; charset=utf-8", payload)
+}
+
+// etagMatches implements the weak comparison If-None-Match calls for: header
+// is "*" or a comma-separated list of tags, each possibly prefixed with W/.
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportFlushEvery controls how many rows are buffered before flushing to
+// the client during an export.
+const exportFlushEvery = 500
+
+var alertCSVHeader = []string{
+	"id", "prediction_id", "threat_id", "severity", "status", "description", "source_ip", "destination_ip",
+	"acknowledged_at", "acknowledged_by", "resolved_at", "resolved_by", "assigned_to", "incident_id", "notes", "occurrence_count", "last_seen_at", "created_at", "updated_at", "deleted_at",
+}
+
+func (a Alert) csvRecord() []string {
+	str := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	ts := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+	return []string{
+		a.ID, str(a.PredictionID), str(a.ThreatID), a.Severity, a.Status, str(a.Description), str(a.SourceIP), str(a.DestinationIP),
+		ts(a.AcknowledgedAt), str(a.AcknowledgedBy), ts(a.ResolvedAt), str(a.ResolvedBy), str(a.AssignedTo), str(a.IncidentID), str(a.Notes), strconv.Itoa(a.Occurrences), a.LastSeenAt.Format(time.RFC3339),
+		a.CreatedAt.Format(time.RFC3339), a.UpdatedAt.Format(time.RFC3339), ts(a.DeletedAt),
+	}
+}
+
+// exportAlerts streams every alert matching the getAlerts filters as CSV
+// (default) or a JSON array. Rows are written as they are read from the
+// cursor, so memory use doesn't grow with the size of the export.
+func exportAlerts(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "json" {
+		c.JSON(400, gin.H{"error": "invalid format: must be csv or json"})
+		return
+	}
+
+	where, args := alertFilters(c)
+	rows, err := readDB().QueryContext(c.Request.Context(), "SELECT "+alertColumns+" FROM alerts"+where+" ORDER BY created_at DESC, id DESC", args...)
+	if err != nil {
+		requestLog(c).Error("Failed to query alerts for export", "error", err)
+		internalError(c, "failed to export alerts")
+		return
+	}
+	defer rows.Close()
+
+	filename := "alerts-" + time.Now().UTC().Format("20060102-150405") + "." + format
+	c.Header("Content-Disposition", "attachment; filename=\""+filename+"\"")
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+	}
+	c.Status(200)
+
+	// Once streaming has started the status is already sent, so failures can
+	// only be logged and the response cut short.
+	var n int
+	var writeRow func(Alert) error
+	var flush func() error
+	var closeOutput func() error
+
+	if format == "csv" {
+		w := csv.NewWriter(c.Writer)
+		if err := w.Write(alertCSVHeader); err != nil {
+			return
+		}
+		writeRow = func(a Alert) error { return w.Write(a.csvRecord()) }
+		flush = func() error { w.Flush(); return w.Error() }
+		closeOutput = flush
+	} else {
+		enc := json.NewEncoder(c.Writer)
+		if _, err := c.Writer.WriteString("["); err != nil {
+			return
+		}
+		writeRow = func(a Alert) error {
+			if n > 0 {
+				if _, err := c.Writer.WriteString(","); err != nil {
+					return err
+				}
+			}
+			return enc.Encode(a)
+		}
+		flush = func() error { return nil }
+		closeOutput = func() error { _, err := c.Writer.WriteString("]\n"); return err }
+	}
+
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			requestLog(c).Error("Failed to scan alert during export", "error", err)
+			return
+		}
+		if err := writeRow(a); err != nil {
+			requestLog(c).Warn("Alert export aborted", "rows", n, "error", err)
+			return
+		}
+		n++
+		if n%exportFlushEvery == 0 {
+			if err := flush(); err != nil {
+				requestLog(c).Warn("Alert export aborted", "rows", n, "error", err)
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(c).Error("Failed to iterate alerts during export", "rows", n, "error", err)
+		return
+	}
+
+	if err := closeOutput(); err != nil {
+		requestLog(c).Warn("Failed to finish alert export", "error", err)
+		return
+	}
+	c.Writer.Flush()
+}
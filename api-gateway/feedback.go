@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Feedback is a traffic signature analysts have marked as a false positive:
+// traffic from the source to the port over the protocol that scored as the
+// threat type. Weight is what analyzeTraffic multiplies the score of new
+// matches by, ANALYZE_FEEDBACK_FACTOR to the power of FalsePositives.
+type Feedback struct {
+	ID             string    `json:"id"`
+	SourceIP       string    `json:"source_ip"`
+	Protocol       string    `json:"protocol"`
+	DestPort       int       `json:"dest_port"`
+	ThreatType     string    `json:"threat_type"`
+	FalsePositives int       `json:"false_positives"`
+	Weight         float64   `json:"weight"`
+	LastAlertID    *string   `json:"last_alert_id"`
+	MarkedBy       string    `json:"marked_by"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// feedbackWeight is the score multiplier for a signature marked a false
+// positive n times.
+func feedbackWeight(n int) float64 {
+	return math.Round(math.Pow(scoringConfig.FeedbackFactor, float64(n))*1000) / 1000
+}
+
+// recordFalsePositives adds the signatures of the given alerts, just marked
+// false_positive, to the feedback table in tx. Alerts whose threat has no
+// stored traffic or threat type give no signature and are skipped. Alerts of
+// the same signature are counted together, since ON CONFLICT can only update
+// a row once per statement.
+func recordFalsePositives(ctx context.Context, tx *sql.Tx, tenant, actor string, alertIDs []string) error {
+	if len(alertIDs) == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `INSERT INTO feedback (tenant_id, source_ip, protocol, dest_port, threat_type, false_positive_count, last_alert_id, marked_by)
+		SELECT a.tenant_id, tr.source_ip, tr.protocol, COALESCE(tr.dest_port, 0), th.threat_type, COUNT(*),
+			(array_agg(a.id ORDER BY a.created_at DESC))[1], $3
+		FROM alerts a
+		JOIN threats th ON th.id = a.threat_id
+		JOIN traffic tr ON tr.id = th.traffic_id
+		WHERE a.id = ANY($1::uuid[]) AND a.tenant_id = $2 AND th.threat_type IS NOT NULL
+		GROUP BY a.tenant_id, tr.source_ip, tr.protocol, COALESCE(tr.dest_port, 0), th.threat_type
+		ON CONFLICT (tenant_id, source_ip, protocol, dest_port, threat_type) DO UPDATE SET
+			false_positive_count = feedback.false_positive_count + EXCLUDED.false_positive_count,
+			last_alert_id = EXCLUDED.last_alert_id,
+			marked_by = EXCLUDED.marked_by,
+			updated_at = CURRENT_TIMESTAMP`,
+		pq.Array(alertIDs), tenant, actor)
+	return err
+}
+
+// feedbackSignature identifies traffic the way the feedback table does.
+type feedbackSignature struct {
+	sourceIP   string
+	protocol   string
+	destPort   int
+	threatType string
+}
+
+// feedbackCounts holds how often each signature was marked a false positive.
+type feedbackCounts map[feedbackSignature]int
+
+// loadFeedback reads the tenant's false-positive counts, for the given
+// source addresses only or, when sourceIPs is nil, for all of them.
+func loadFeedback(ctx context.Context, tenant string, sourceIPs []string) (feedbackCounts, error) {
+	counts := feedbackCounts{}
+	if scoringConfig.FeedbackFactor == 1 || sourceIPs != nil && len(sourceIPs) == 0 {
+		return counts, nil
+	}
+	query := "SELECT source_ip, protocol, dest_port, threat_type, false_positive_count FROM feedback WHERE tenant_id = $1"
+	args := []interface{}{tenant}
+	if sourceIPs != nil {
+		query += " AND source_ip = ANY($2)"
+		args = append(args, pq.Array(sourceIPs))
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sig feedbackSignature
+		var n int
+		if err := rows.Scan(&sig.sourceIP, &sig.protocol, &sig.destPort, &sig.threatType, &n); err != nil {
+			return nil, err
+		}
+		counts[sig] = n
+	}
+	return counts, rows.Err()
+}
+
+// apply down-weights a threat verdict whose signature has been marked a false
+// positive and relabels it for the lower score, returning the weight applied
+// (1 for none).
+func (f feedbackCounts) apply(req AnalyzeRequest, v Verdict) (Verdict, float64) {
+	if !v.isThreat() {
+		return v, 1
+	}
+	n, ok := f[feedbackSignature{req.SourceIP, req.Protocol, *req.DestPort, *v.ThreatType}]
+	if !ok {
+		return v, 1
+	}
+
+	weight := feedbackWeight(n)
+	v.Score = math.Round(v.Score*weight*1000) / 1000
+	v.Label = labelForScore(v.Score, true, scoringConfig)
+	if !v.isThreat() {
+		v.ThreatType = nil
+	}
+	return v, weight
+}
+
+// applyFeedback applies the tenant's false-positive feedback to verdicts, the
+// scores of reqs, in place and returns the weight applied to each. A lookup
+// error leaves the verdicts as they are, so an outage can't hide threats.
+func applyFeedback(c *gin.Context, reqs []AnalyzeRequest, verdicts []Verdict) []float64 {
+	sources := []string{}
+	for i, v := range verdicts {
+		if v.isThreat() {
+			sources = append(sources, reqs[i].SourceIP)
+		}
+	}
+	counts, err := loadFeedback(c.Request.Context(), tenantFromContext(c), sources)
+	if err != nil {
+		requestLog(c).Warn("Failed to look up false-positive feedback, scoring normally", "error", err)
+		counts = feedbackCounts{}
+	}
+	weights := make([]float64, len(verdicts))
+	for i := range verdicts {
+		verdicts[i], weights[i] = counts.apply(reqs[i], verdicts[i])
+	}
+	return weights
+}
+
+// listFeedback returns the tenant's false-positive signatures with the weight
+// currently applied to each, most recently marked first.
+func listFeedback(c *gin.Context) {
+	page, err := parsePage(c, defaultPageSpec)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	tenant := tenantFromContext(c)
+
+	var total int
+	rdb := readDB()
+	if err := rdb.QueryRowContext(c.Request.Context(), "SELECT COUNT(*) FROM feedback WHERE tenant_id = $1", tenant).Scan(&total); err != nil {
+		requestLog(c).Error("Failed to count feedback", "error", err)
+		internalError(c, "failed to fetch feedback")
+		return
+	}
+
+	rows, err := rdb.QueryContext(c.Request.Context(), `SELECT id, source_ip, protocol, dest_port, threat_type, false_positive_count, last_alert_id, marked_by, created_at, updated_at
+		FROM feedback WHERE tenant_id = $1 ORDER BY updated_at DESC, id DESC
+		LIMIT $2 OFFSET $3`, tenant, page.Limit, page.Offset())
+	if err != nil {
+		requestLog(c).Error("Failed to query feedback", "error", err)
+		internalError(c, "failed to fetch feedback")
+		return
+	}
+	defer rows.Close()
+
+	entries := []Feedback{}
+	for rows.Next() {
+		var f Feedback
+		if err := rows.Scan(&f.ID, &f.SourceIP, &f.Protocol, &f.DestPort, &f.ThreatType, &f.FalsePositives, &f.LastAlertID, &f.MarkedBy, &f.CreatedAt, &f.UpdatedAt); err != nil {
+			requestLog(c).Error("Failed to scan feedback", "error", err)
+			internalError(c, "failed to fetch feedback")
+			return
+		}
+		f.Weight = feedbackWeight(f.FalsePositives)
+		entries = append(entries, f)
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(c).Error("Failed to iterate feedback", "error", err)
+		internalError(c, "failed to fetch feedback")
+		return
+	}
+
+	setPageLinks(c, total, page)
+	respond(c, 200, entries, gin.H{"pagination": newPagination(total, page)})
+}
@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestFeedbackCountsApply(t *testing.T) {
+	saved := scoringConfig
+	t.Cleanup(func() { scoringConfig = saved })
+	scoringConfig = ScoringConfig{MaliciousThreshold: 0.7, SuspiciousThreshold: 0.4, UnmatchedLabel: "benign", FeedbackFactor: 0.5}
+
+	port := 22
+	req := AnalyzeRequest{SourceIP: "10.0.0.1", Protocol: "tcp", DestPort: &port}
+	threatType := "R2L"
+	verdict := Verdict{Score: 0.9, Label: "malicious", ThreatType: &threatType}
+	sig := feedbackSignature{"10.0.0.1", "tcp", 22, "R2L"}
+
+	tests := []struct {
+		name       string
+		counts     feedbackCounts
+		wantScore  float64
+		wantLabel  string
+		wantWeight float64
+	}{
+		{"no feedback", feedbackCounts{}, 0.9, "malicious", 1},
+		{"other signature", feedbackCounts{{"10.0.0.2", "tcp", 22, "R2L"}: 3}, 0.9, "malicious", 1},
+		{"marked once", feedbackCounts{sig: 1}, 0.45, "suspicious", 0.5},
+		{"marked twice", feedbackCounts{sig: 2}, 0.225, "benign", 0.25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, weight := tt.counts.apply(req, verdict)
+			if got.Score != tt.wantScore || got.Label != tt.wantLabel || weight != tt.wantWeight {
+				t.Errorf("apply = (score %g, label %q, weight %g), want (%g, %q, %g)",
+					got.Score, got.Label, weight, tt.wantScore, tt.wantLabel, tt.wantWeight)
+			}
+			if got.isThreat() != (got.ThreatType != nil) {
+				t.Errorf("threat type %v doesn't match label %q", got.ThreatType, got.Label)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"log"
+	"net"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// MaxMind readers opened at startup from GEOIP_CITY_DB and GEOIP_ASN_DB. Both
+// are optional; without them traffic is stored without geo fields.
+var (
+	geoCityDB *geoip2.Reader
+	geoASNDB  *geoip2.Reader
+)
+
+func initGeoIP() {
+	geoCityDB = openGeoDB("GEOIP_CITY_DB")
+	geoASNDB = openGeoDB("GEOIP_ASN_DB")
+}
+
+func openGeoDB(env string) *geoip2.Reader {
+	path := getEnv(env, "")
+	if path == "" {
+		return nil
+	}
+	r, err := geoip2.Open(path)
+	if err != nil {
+		log.Printf("GeoIP database %s unavailable, skipping enrichment: %v", path, err)
+		return nil
+	}
+	log.Printf("GeoIP database loaded from %s", path)
+	return r
+}
+
+func closeGeoIP() {
+	for _, r := range []*geoip2.Reader{geoCityDB, geoASNDB} {
+		if r != nil {
+			r.Close()
+		}
+	}
+}
+
+// GeoInfo is the geographic enrichment stored with a traffic record. Fields
+// are nil when no database is loaded or the address isn't in it.
+type GeoInfo struct {
+	Country *string // ISO 3166-1 alpha-2 code
+	City    *string
+	ASN     *int64
+	ASOrg   *string
+}
+
+// lookupGeo resolves ip against the loaded databases. Lookup errors leave the
+// fields nil rather than failing the caller.
+func lookupGeo(ip string) GeoInfo {
+	var geo GeoInfo
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return geo
+	}
+	if geoCityDB != nil {
+		if city, err := geoCityDB.City(addr); err == nil {
+			geo.Country = nonEmpty(city.Country.IsoCode)
+			geo.City = nonEmpty(city.City.Names["en"])
+		}
+	}
+	if geoASNDB != nil {
+		if asn, err := geoASNDB.ASN(addr); err == nil && asn.AutonomousSystemNumber != 0 {
+			n := int64(asn.AutonomousSystemNumber)
+			geo.ASN = &n
+			geo.ASOrg = nonEmpty(asn.AutonomousSystemOrganization)
+		}
+	}
+	return geo
+}
+
+func nonEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
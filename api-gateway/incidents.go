@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+const maxIncidentAlerts = 200
+
+// incidentGroupWindow is how recently another alert from the same source must
+// have been seen for a new alert to be grouped with it. Set by
+// INCIDENT_GROUP_WINDOW.
+var incidentGroupWindow = time.Hour
+
+// Incident mirrors a row of the incidents table. Severity is not stored: it is
+// the highest severity among the member alerts, so it follows escalations and
+// edits of those alerts without further bookkeeping.
+type Incident struct {
+	ID         string    `json:"id"`
+	TenantID   string    `json:"tenant_id"`
+	Title      string    `json:"title"`
+	SourceIP   *string   `json:"source_ip"`
+	Severity   *string   `json:"severity"`
+	AlertCount int       `json:"alert_count"`
+	CreatedBy  *string   `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+const incidentColumns = `id, tenant_id, title, source_ip, created_by, created_at, updated_at`
+
+func scanIncident(s rowScanner) (Incident, error) {
+	var i Incident
+	err := s.Scan(&i.ID, &i.TenantID, &i.Title, &i.SourceIP, &i.CreatedBy, &i.CreatedAt, &i.UpdatedAt)
+	return i, err
+}
+
+// withAlerts fills in the fields derived from the incident's member alerts.
+func (i *Incident) withAlerts(alerts []Alert) {
+	i.AlertCount = len(alerts)
+	i.Severity = nil
+	for _, a := range alerts {
+		if i.Severity == nil || severityRank(a.Severity) > severityRank(*i.Severity) {
+			severity := a.Severity
+			i.Severity = &severity
+		}
+	}
+}
+
+// CreateIncidentRequest is the body of POST /incidents.
+type CreateIncidentRequest struct {
+	Title    string   `json:"title" binding:"required"`
+	AlertIDs []string `json:"alert_ids" binding:"required"`
+}
+
+// createIncident groups the given alerts into a new incident. Every alert must
+// exist and must not already belong to an incident; otherwise nothing is
+// created and the offending ids are reported.
+func createIncident(c *gin.Context) {
+	var req CreateIncidentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+		return
+	}
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Title == "" {
+		c.JSON(400, gin.H{"error": "title must not be empty"})
+		return
+	}
+	if len(req.AlertIDs) == 0 {
+		c.JSON(400, gin.H{"error": "alert_ids must not be empty"})
+		return
+	}
+	if len(req.AlertIDs) > maxIncidentAlerts {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("too many alert_ids: at most %d per incident", maxIncidentAlerts)})
+		return
+	}
+	for i, id := range req.AlertIDs {
+		if !isValidUUID(id) {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("invalid alert id %q", id)})
+			return
+		}
+		req.AlertIDs[i] = strings.ToLower(id)
+	}
+
+	ctx := c.Request.Context()
+	tenant := tenantFromContext(c)
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		requestLog(c).Error("Failed to begin transaction", "error", err)
+		internalError(c, "failed to create incident")
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the alerts so a concurrent request can't put them in another
+	// incident between the check and the update.
+	rows, err := tx.QueryContext(ctx, `SELECT id, incident_id FROM alerts
+		WHERE id = ANY($1::uuid[]) AND tenant_id = $2 AND deleted_at IS NULL
+		FOR UPDATE`, pq.Array(req.AlertIDs), tenant)
+	if err != nil {
+		requestLog(c).Error("Failed to lock alerts for incident", "error", err)
+		internalError(c, "failed to create incident")
+		return
+	}
+	found := map[string]bool{}
+	grouped := []string{}
+	for rows.Next() {
+		var id string
+		var incidentID *string
+		if err := rows.Scan(&id, &incidentID); err != nil {
+			rows.Close()
+			requestLog(c).Error("Failed to scan alert", "error", err)
+			internalError(c, "failed to create incident")
+			return
+		}
+		found[id] = true
+		if incidentID != nil {
+			grouped = append(grouped, id)
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		requestLog(c).Error("Failed to iterate alerts for incident", "error", err)
+		internalError(c, "failed to create incident")
+		return
+	}
+
+	notFound := []string{}
+	for _, id := range req.AlertIDs {
+		if !found[id] {
+			notFound = append(notFound, id)
+		}
+	}
+	if len(notFound) > 0 {
+		c.JSON(404, gin.H{"error": "alerts not found", "not_found": notFound})
+		return
+	}
+	if len(grouped) > 0 {
+		c.JSON(409, gin.H{"error": "alerts already belong to an incident", "alert_ids": grouped})
+		return
+	}
+
+	incident, err := scanIncident(tx.QueryRowContext(ctx,
+		"INSERT INTO incidents (tenant_id, title, created_by) VALUES ($1, $2, $3) RETURNING "+incidentColumns,
+		tenant, req.Title, actorFromContext(c)))
+	if err != nil {
+		requestLog(c).Error("Failed to insert incident", "error", err)
+		internalError(c, "failed to create incident")
+		return
+	}
+	alerts, err := queryAlerts(ctx, tx, "UPDATE alerts SET incident_id = $1 WHERE id = ANY($2::uuid[]) AND tenant_id = $3 RETURNING "+alertColumns,
+		incident.ID, pq.Array(req.AlertIDs), tenant)
+	if err != nil {
+		requestLog(c).Error("Failed to link alerts to incident", "incident_id", incident.ID, "error", err)
+		internalError(c, "failed to create incident")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		requestLog(c).Error("Failed to commit incident", "error", err)
+		internalError(c, "failed to create incident")
+		return
+	}
+
+	incident.withAlerts(alerts)
+	respond(c, 201, incident, gin.H{"alerts": alerts})
+}
+
+func getIncident(c *gin.Context) {
+	id := c.Param("id")
+	if !isValidUUID(id) {
+		c.JSON(400, gin.H{"error": "invalid incident id"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	tenant := tenantFromContext(c)
+	incident, err := scanIncident(db.QueryRowContext(ctx, "SELECT "+incidentColumns+" FROM incidents WHERE id = $1 AND tenant_id = $2", id, tenant))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"error": "incident not found"})
+		return
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to fetch incident", "incident_id", id, "error", err)
+		internalError(c, "failed to fetch incident")
+		return
+	}
+
+	alerts, err := queryAlerts(ctx, db, "SELECT "+alertColumns+" FROM alerts WHERE incident_id = $1 AND tenant_id = $2 ORDER BY created_at ASC", id, tenant)
+	if err != nil {
+		requestLog(c).Error("Failed to query incident alerts", "incident_id", id, "error", err)
+		internalError(c, "failed to fetch incident")
+		return
+	}
+
+	incident.withAlerts(alerts)
+	respond(c, 200, incident, gin.H{"alerts": alerts})
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// queryAlerts runs a query returning alertColumns and scans every row.
+func queryAlerts(ctx context.Context, q queryer, query string, args ...interface{}) ([]Alert, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []Alert{}
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+// groupAlertIntoIncident links a newly raised alert with other alerts from the
+// same source seen within incidentGroupWindow. It joins the incident of the
+// most recent such alert, or opens a new incident holding all of them if none
+// is grouped yet. It returns the incident id, or nil when the alert stays
+// ungrouped.
+func groupAlertIntoIncident(ctx context.Context, tx *sql.Tx, tenant string, alert Alert) (*string, error) {
+	if incidentGroupWindow <= 0 || alert.SourceIP == nil {
+		return nil, nil
+	}
+	sourceIP := *alert.SourceIP
+
+	// Serialize grouping per source so two concurrent alerts can't each open
+	// their own incident.
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", "incident:"+tenant+"|"+sourceIP); err != nil {
+		return nil, err
+	}
+
+	window := incidentGroupWindow.Seconds()
+	var incidentID *string
+	err := tx.QueryRowContext(ctx, `SELECT incident_id FROM alerts
+		WHERE tenant_id = $1 AND source_ip = $2 AND id <> $3 AND deleted_at IS NULL
+			AND last_seen_at >= LOCALTIMESTAMP - make_interval(secs => $4)
+		ORDER BY last_seen_at DESC
+		LIMIT 1`, tenant, sourceIP, alert.ID, window).Scan(&incidentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if incidentID == nil {
+		var id string
+		err := tx.QueryRowContext(ctx, "INSERT INTO incidents (tenant_id, title, source_ip) VALUES ($1, $2, $3) RETURNING id",
+			tenant, "Repeated alerts from "+sourceIP, sourceIP).Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE alerts SET incident_id = $1
+			WHERE tenant_id = $2 AND source_ip = $3 AND incident_id IS NULL AND deleted_at IS NULL
+				AND last_seen_at >= LOCALTIMESTAMP - make_interval(secs => $4)`, id, tenant, sourceIP, window)
+		if err != nil {
+			return nil, err
+		}
+		return &id, nil
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE alerts SET incident_id = $1 WHERE id = $2", *incidentID, alert.ID)
+	if err != nil {
+		return nil, err
+	}
+	return incidentID, nil
+}
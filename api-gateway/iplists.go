@@ -0,0 +1,189 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// IPListEntry mirrors a row of the ip_lists table. Records from a denylisted
+// source are refused at ingestion; allowlisted ones are labeled benign.
+type IPListEntry struct {
+	ID        string    `json:"id"`
+	CIDR      string    `json:"cidr"`
+	ListType  string    `json:"list_type"`
+	Reason    *string   `json:"reason"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const ipListColumns = `id, cidr, list_type, reason, created_by, created_at`
+
+func scanIPListEntry(s rowScanner) (IPListEntry, error) {
+	var e IPListEntry
+	err := s.Scan(&e.ID, &e.CIDR, &e.ListType, &e.Reason, &e.CreatedBy, &e.CreatedAt)
+	return e, err
+}
+
+// ipListCacheKey is the Redis key the ingestion service caches a tenant's
+// lists under; it is deleted whenever the lists change.
+func ipListCacheKey(tenant string) string {
+	return "iplists:" + tenant
+}
+
+// normalizeCIDR accepts a CIDR or a bare address (treated as a single-host
+// network) and returns it in the canonical network form Postgres expects.
+func normalizeCIDR(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return "", fmt.Errorf("invalid cidr %q", s)
+		}
+		if v4 := ip.To4(); v4 != nil {
+			return v4.String() + "/32", nil
+		}
+		return ip.String() + "/128", nil
+	}
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid cidr %q", s)
+	}
+	return network.String(), nil
+}
+
+func listIPLists(c *gin.Context) {
+	page, err := parsePage(c, defaultPageSpec)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	conditions := []string{"tenant_id = $1"}
+	args := []interface{}{tenantFromContext(c)}
+	if listType := c.Query("list_type"); listType != "" {
+		if listType != "allow" && listType != "deny" {
+			c.JSON(400, gin.H{"error": "invalid list_type: must be allow or deny"})
+			return
+		}
+		args = append(args, listType)
+		conditions = append(conditions, "list_type = $2")
+	}
+
+	where := " WHERE " + strings.Join(conditions, " AND ")
+
+	var total int
+	rdb := readDB()
+	if err := rdb.QueryRowContext(c.Request.Context(), "SELECT COUNT(*) FROM ip_lists"+where, args...).Scan(&total); err != nil {
+		requestLog(c).Error("Failed to count IP lists", "error", err)
+		internalError(c, "failed to fetch IP lists")
+		return
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM ip_lists%s ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d",
+		ipListColumns, where, len(args)+1, len(args)+2)
+	rows, err := rdb.QueryContext(c.Request.Context(), query, append(args, page.Limit, page.Offset())...)
+	if err != nil {
+		requestLog(c).Error("Failed to query IP lists", "error", err)
+		internalError(c, "failed to fetch IP lists")
+		return
+	}
+	defer rows.Close()
+
+	entries := []IPListEntry{}
+	for rows.Next() {
+		e, err := scanIPListEntry(rows)
+		if err != nil {
+			requestLog(c).Error("Failed to scan IP list entry", "error", err)
+			internalError(c, "failed to fetch IP lists")
+			return
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(c).Error("Failed to iterate IP lists", "error", err)
+		internalError(c, "failed to fetch IP lists")
+		return
+	}
+
+	setPageLinks(c, total, page)
+	respond(c, 200, entries, gin.H{"pagination": newPagination(total, page)})
+}
+
+// CreateIPListEntryRequest is the body of POST /ip-lists.
+type CreateIPListEntryRequest struct {
+	CIDR     string  `json:"cidr" binding:"required"`
+	ListType string  `json:"list_type" binding:"required,oneof=allow deny"`
+	Reason   *string `json:"reason"`
+}
+
+func createIPListEntry(c *gin.Context) {
+	var req CreateIPListEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+		return
+	}
+	cidr, err := normalizeCIDR(req.CIDR)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenant := tenantFromContext(c)
+	entry, err := scanIPListEntry(db.QueryRowContext(c.Request.Context(),
+		`INSERT INTO ip_lists (tenant_id, cidr, list_type, reason, created_by)
+		VALUES ($1, $2, $3, $4, $5) RETURNING `+ipListColumns,
+		tenant, cidr, req.ListType, req.Reason, actorFromContext(c),
+	))
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		c.JSON(409, gin.H{"error": fmt.Sprintf("%s is already on the %s list", cidr, req.ListType)})
+		return
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to insert IP list entry", "error", err)
+		internalError(c, "failed to create IP list entry")
+		return
+	}
+
+	invalidateIPListCache(c, tenant)
+	respond(c, 201, entry, nil)
+}
+
+func deleteIPListEntry(c *gin.Context) {
+	id := c.Param("id")
+	if !isValidUUID(id) {
+		c.JSON(400, gin.H{"error": "invalid IP list entry id"})
+		return
+	}
+
+	tenant := tenantFromContext(c)
+	_, err := scanIPListEntry(db.QueryRowContext(c.Request.Context(),
+		"DELETE FROM ip_lists WHERE id = $1 AND tenant_id = $2 RETURNING "+ipListColumns, id, tenant))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"error": "IP list entry not found"})
+		return
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to delete IP list entry", "entry_id", id, "error", err)
+		internalError(c, "failed to delete IP list entry")
+		return
+	}
+
+	invalidateIPListCache(c, tenant)
+	c.Status(204)
+}
+
+// invalidateIPListCache makes the ingestion service reload the tenant's lists
+// on its next request. If Redis is down the change applies once the cached
+// copy expires.
+func invalidateIPListCache(c *gin.Context, tenant string) {
+	if err := redisClient.Del(c.Request.Context(), ipListCacheKey(tenant)).Err(); err != nil {
+		requestLog(c).Warn("Failed to invalidate IP list cache", "error", err)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTClaims are the claims accepted on bearer tokens. Roles double as scopes
+// for requireScope, so a token needs e.g. "read" to call GET endpoints.
+// Tokens without a tenant_id claim belong to the default tenant.
+type JWTClaims struct {
+	Roles    []string `json:"roles"`
+	TenantID string   `json:"tenant_id"`
+	jwt.RegisteredClaims
+}
+
+// jwtKeyFunc verifies token signatures; nil when JWT auth is not configured.
+var jwtKeyFunc jwt.Keyfunc
+
+// initJWT configures bearer-token verification. JWT_PUBLIC_KEY_FILE (a PEM
+// RSA or ECDSA public key) takes precedence over the shared JWT_SECRET used
+// for HMAC-signed tokens. With neither set, only API keys are accepted.
+func initJWT() {
+	if path := os.Getenv("JWT_PUBLIC_KEY_FILE"); path != "" {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatal("Failed to read JWT public key:", err)
+		}
+		var pub crypto.PublicKey
+		if pub, err = jwt.ParseRSAPublicKeyFromPEM(pem); err != nil {
+			if pub, err = jwt.ParseECPublicKeyFromPEM(pem); err != nil {
+				log.Fatal("Failed to parse JWT public key: expected an RSA or ECDSA PEM key")
+			}
+		}
+		jwtKeyFunc = func(t *jwt.Token) (interface{}, error) {
+			switch t.Method.(type) {
+			case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+				return pub, nil
+			}
+			return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+		}
+		log.Println("JWT authentication enabled (public key)")
+		return
+	}
+
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		jwtKeyFunc = func(t *jwt.Token) (interface{}, error) {
+			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+			}
+			return []byte(secret), nil
+		}
+		log.Println("JWT authentication enabled (shared secret)")
+	}
+}
+
+// parseJWT verifies the token's signature and expiry and returns its claims.
+func parseJWT(token string) (*JWTClaims, error) {
+	claims := &JWTClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, jwtKeyFunc, jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+	return claims, nil
+}
+
+// authMiddleware accepts either a bearer JWT or an X-API-Key. The JWT is tried
+// first; if it is missing or invalid the request falls back to API key auth,
+// unless no API key was sent either, in which case the JWT error is reported.
+func authMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token, ok := bearerToken(c); ok && jwtKeyFunc != nil {
+			claims, err := parseJWT(token)
+			if err == nil {
+				c.Set("jwt_subject", claims.Subject)
+				c.Set("jwt_roles", claims.Roles)
+				c.Set("scopes", claims.Roles)
+				tenant := claims.TenantID
+				if tenant == "" {
+					tenant = defaultTenantID
+				}
+				c.Set("tenant_id", tenant)
+				c.Set("actor", "user:"+claims.Subject)
+				c.Next()
+				return
+			}
+			if c.GetHeader("X-API-Key") == "" {
+				c.JSON(401, gin.H{"error": "Unauthorized - invalid bearer token: " + err.Error()})
+				c.Abort()
+				return
+			}
+		}
+
+		if !authenticateAPIKey(c) {
+			return
+		}
+		c.Next()
+	}
+}
+
+func bearerToken(c *gin.Context) (string, bool) {
+	header := c.GetHeader("Authorization")
+	const prefix = "Bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(header[len(prefix):]), true
+}
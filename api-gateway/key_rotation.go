@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxKeyRotationGrace bounds ?grace_period=, so a rotation can't leave the
+	// old secret working indefinitely.
+	maxKeyRotationGrace = 7 * 24 * time.Hour
+
+	keyRotationWindow = time.Hour
+)
+
+// keyRotationGrace is how long the previous secret keeps working after a
+// rotation when the request doesn't say. Set by KEY_ROTATION_GRACE_PERIOD.
+var keyRotationGrace time.Duration
+
+// keyRotationLimit is how many times one key may be rotated per
+// keyRotationWindow. Set by KEY_ROTATION_LIMIT_PER_HOUR.
+var keyRotationLimit = 5
+
+// RotatedKey is the answer to a rotation. Key is the only time the new secret
+// is shown; afterwards only its hash is stored.
+type RotatedKey struct {
+	ID                   string     `json:"id"`
+	Name                 string     `json:"name"`
+	Key                  string     `json:"key"`
+	RotatedAt            time.Time  `json:"rotated_at"`
+	PreviousKeyExpiresAt *time.Time `json:"previous_key_expires_at"`
+}
+
+// newAPIKeySecret returns a random 256-bit key.
+func newAPIKeySecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// allowKeyRotation counts a rotation of keyID against keyRotationLimit and
+// reports whether it may go ahead. The counter is a fixed window started by
+// the first rotation. If Redis is unavailable the rotation is let through.
+func allowKeyRotation(c *gin.Context, keyID string) bool {
+	ctx := c.Request.Context()
+	counter := "ratelimit:key-rotate:" + keyID
+	n, err := redisClient.Incr(ctx, counter).Result()
+	if err != nil {
+		requestLog(c).Warn("Key rotation limiter unavailable, allowing rotation", "key_id", keyID, "error", err)
+		return true
+	}
+	if n == 1 {
+		redisClient.Expire(ctx, counter, keyRotationWindow)
+	}
+	if n <= int64(keyRotationLimit) {
+		return true
+	}
+	retryAfter := int64(keyRotationWindow.Seconds())
+	if ttl, err := redisClient.TTL(ctx, counter).Result(); err == nil && ttl > 0 {
+		retryAfter = int64(ttl.Seconds()) + 1
+	}
+	c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+	c.JSON(429, gin.H{"error": "key rotation limit exceeded", "limit_per_hour": keyRotationLimit})
+	return false
+}
+
+// rotateAPIKey replaces a key's secret with a new random one and returns it.
+// With ?grace_period= (default keyRotationGrace) the previous secret keeps
+// working for that long so clients can migrate; a previous secret still in
+// its grace period from an earlier rotation stops working right away. The
+// cached lookups of the replaced secrets are dropped, so nothing outlives
+// the grace period.
+func rotateAPIKey(c *gin.Context) {
+	id := c.Param("id")
+	if !isValidUUID(id) {
+		c.JSON(400, gin.H{"error": "invalid key id"})
+		return
+	}
+	grace := keyRotationGrace
+	if v := c.Query("grace_period"); v != "" {
+		d, err := parseRetention(v)
+		if err != nil || d < 0 {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("invalid grace_period %q: use e.g. 24h or 2d", v)})
+			return
+		}
+		grace = d
+	}
+	if grace > maxKeyRotationGrace {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("grace_period must be at most %s", maxKeyRotationGrace)})
+		return
+	}
+	if !allowKeyRotation(c, id) {
+		return
+	}
+
+	secret, err := newAPIKeySecret()
+	if err != nil {
+		requestLog(c).Error("Failed to generate API key", "error", err)
+		internalError(c, "failed to rotate API key")
+		return
+	}
+
+	ctx := c.Request.Context()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		requestLog(c).Error("Failed to begin transaction", "error", err)
+		internalError(c, "failed to rotate API key")
+		return
+	}
+	defer tx.Rollback()
+
+	var name, oldHash string
+	var previousHash *string
+	var active bool
+	err = tx.QueryRowContext(ctx, "SELECT name, key_hash, previous_key_hash, is_active FROM api_keys WHERE id = $1 AND tenant_id = $2 FOR UPDATE",
+		id, tenantFromContext(c)).Scan(&name, &oldHash, &previousHash, &active)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"error": "API key not found"})
+		return
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to lock API key", "key_id", id, "error", err)
+		internalError(c, "failed to rotate API key")
+		return
+	}
+	if !active {
+		c.JSON(409, gin.H{"error": "API key is revoked"})
+		return
+	}
+
+	// Columns are TIMESTAMP without time zone and written in UTC.
+	rotated := RotatedKey{ID: id, Name: name, Key: secret, RotatedAt: time.Now().UTC()}
+	var keepHash *string
+	if grace > 0 {
+		expires := rotated.RotatedAt.Add(grace)
+		keepHash, rotated.PreviousKeyExpiresAt = &oldHash, &expires
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE api_keys
+		SET key_hash = $1, previous_key_hash = $2, previous_key_expires_at = $3, rotated_at = $4
+		WHERE id = $5`, hashAPIKey(secret), keepHash, rotated.PreviousKeyExpiresAt, rotated.RotatedAt, id)
+	if err != nil {
+		requestLog(c).Error("Failed to update API key", "key_id", id, "error", err)
+		internalError(c, "failed to rotate API key")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		requestLog(c).Error("Failed to commit API key rotation", "key_id", id, "error", err)
+		internalError(c, "failed to rotate API key")
+		return
+	}
+
+	stale := []string{"apikey:" + oldHash}
+	if previousHash != nil {
+		stale = append(stale, "apikey:"+*previousHash)
+	}
+	if err := redisClient.Del(ctx, stale...).Err(); err != nil {
+		requestLog(c).Error("Failed to invalidate API key cache; replaced secrets work until it expires",
+			"key_id", id, "cache_ttl", apiKeyCacheTTL, "error", err)
+	}
+
+	requestLog(c).Info("Rotated API key", "key_id", id, "actor", actorFromContext(c), "grace_period", grace)
+	recordAdminAction(c, "key_rotation", &id, gin.H{"grace_period": grace.String(), "previous_key_expires_at": rotated.PreviousKeyExpiresAt})
+	c.Header("Cache-Control", "no-store")
+	respond(c, 200, rotated, nil)
+}
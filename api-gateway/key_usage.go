@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+)
+
+// Per-key request counts and last-use times are accumulated in these Redis
+// hashes (field = key id) and periodically added to api_keys, so
+// authentication never writes to Postgres.
+const (
+	keyUsageCountsKey   = "apikey:usage:counts"
+	keyUsageLastUsedKey = "apikey:usage:last_used"
+)
+
+// keyUsageFlushInterval is how often runKeyUsageFlusher moves the Redis
+// counters into api_keys. Set by KEY_USAGE_FLUSH_INTERVAL.
+var keyUsageFlushInterval = time.Minute
+
+// recordKeyUsage counts one request for the key. Failures only cost accuracy,
+// so they are logged and otherwise ignored.
+func recordKeyUsage(c *gin.Context, keyID string) {
+	_, err := redisClient.Pipelined(c.Request.Context(), func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(c.Request.Context(), keyUsageCountsKey, keyID, 1)
+		pipe.HSet(c.Request.Context(), keyUsageLastUsedKey, keyID, time.Now().Unix())
+		return nil
+	})
+	if err != nil {
+		requestLog(c).Warn("Failed to record API key usage", "key_id", keyID, "error", err)
+	}
+}
+
+// keyUsageDelta is the not-yet-flushed usage of one key.
+type keyUsageDelta struct {
+	Count    int64
+	LastUsed *time.Time
+}
+
+// readKeyUsage returns the pending usage per key id. With take set, the hashes
+// are emptied in the same MULTI, so on several replicas every increment is
+// flushed by exactly one of them.
+func readKeyUsage(ctx context.Context, take bool) (map[string]keyUsageDelta, error) {
+	var counts, lastUsed *redis.MapStringStringCmd
+	_, err := redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		counts = pipe.HGetAll(ctx, keyUsageCountsKey)
+		lastUsed = pipe.HGetAll(ctx, keyUsageLastUsedKey)
+		if take {
+			pipe.Del(ctx, keyUsageCountsKey, keyUsageLastUsedKey)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	usage := map[string]keyUsageDelta{}
+	for id, v := range counts.Val() {
+		n, _ := strconv.ParseInt(v, 10, 64)
+		usage[id] = keyUsageDelta{Count: n}
+	}
+	for id, v := range lastUsed.Val() {
+		sec, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			continue
+		}
+		t := time.Unix(sec, 0).UTC()
+		d := usage[id]
+		d.LastUsed = &t
+		usage[id] = d
+	}
+	return usage, nil
+}
+
+// runKeyUsageFlusher adds the accumulated usage to api_keys every
+// keyUsageFlushInterval until ctx is cancelled, with a final flush on the way
+// out.
+func runKeyUsageFlusher(ctx context.Context) {
+	ticker := time.NewTicker(keyUsageFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			flushKeyUsage(flushCtx)
+			cancel()
+			return
+		case <-ticker.C:
+			flushKeyUsage(ctx)
+		}
+	}
+}
+
+func flushKeyUsage(ctx context.Context) {
+	usage, err := readKeyUsage(ctx, true)
+	if err != nil {
+		slog.Warn("Failed to read API key usage", "error", err)
+		return
+	}
+	for id, d := range usage {
+		_, err := db.ExecContext(ctx, `UPDATE api_keys
+			SET request_count = request_count + $2, last_used_at = GREATEST(last_used_at, $3)
+			WHERE id = $1`, id, d.Count, d.LastUsed)
+		if err == nil {
+			continue
+		}
+		// Put the counts back so they are retried on the next flush.
+		slog.Warn("Failed to flush API key usage", "key_id", id, "error", err)
+		if err := redisClient.HIncrBy(ctx, keyUsageCountsKey, id, d.Count).Err(); err != nil {
+			slog.Warn("Failed to restore API key usage", "key_id", id, "requests", d.Count, "error", err)
+		}
+		if d.LastUsed != nil {
+			redisClient.HSet(ctx, keyUsageLastUsedKey, id, d.LastUsed.Unix())
+		}
+	}
+}
+
+// KeyUsage describes an API key and how much it is used.
+type KeyUsage struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	Scopes       []string   `json:"scopes"`
+	IsActive     bool       `json:"is_active"`
+	RequestCount int64      `json:"request_count"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+}
+
+// listKeyUsage lists the tenant's API keys with their request counts and last
+// use, least recently used first so candidates for revocation come first.
+// Usage not yet flushed to the database is included, which can reorder keys,
+// so the page is cut after sorting rather than in SQL.
+func listKeyUsage(c *gin.Context) {
+	page, err := parsePage(c, defaultPageSpec)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	pending, err := readKeyUsage(ctx, false)
+	if err != nil {
+		requestLog(c).Warn("Failed to read pending API key usage", "error", err)
+	}
+
+	rows, err := readDB().QueryContext(ctx, `SELECT id, name, scopes, is_active, request_count, last_used_at, created_at, expires_at
+		FROM api_keys
+		WHERE tenant_id = $1
+		ORDER BY name ASC`, tenantFromContext(c))
+	if err != nil {
+		requestLog(c).Error("Failed to query API key usage", "error", err)
+		internalError(c, "failed to fetch API key usage")
+		return
+	}
+	defer rows.Close()
+
+	keys := []KeyUsage{}
+	for rows.Next() {
+		var k KeyUsage
+		if err := rows.Scan(&k.ID, &k.Name, pq.Array(&k.Scopes), &k.IsActive, &k.RequestCount, &k.LastUsedAt, &k.CreatedAt, &k.ExpiresAt); err != nil {
+			requestLog(c).Error("Failed to scan API key usage", "error", err)
+			internalError(c, "failed to fetch API key usage")
+			return
+		}
+		if d, ok := pending[k.ID]; ok {
+			k.RequestCount += d.Count
+			if d.LastUsed != nil && (k.LastUsedAt == nil || d.LastUsed.After(*k.LastUsedAt)) {
+				k.LastUsedAt = d.LastUsed
+			}
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(c).Error("Failed to iterate API key usage", "error", err)
+		internalError(c, "failed to fetch API key usage")
+		return
+	}
+
+	// Sorted here rather than in SQL since pending usage can move keys.
+	sort.SliceStable(keys, func(i, j int) bool {
+		a, b := keys[i].LastUsedAt, keys[j].LastUsedAt
+		if a == nil || b == nil {
+			return a == nil && b != nil
+		}
+		return a.Before(*b)
+	})
+
+	total := len(keys)
+	keys = keys[min(page.Offset(), total):min(page.Offset()+page.Limit, total)]
+	setPageLinks(c, total, page)
+	respond(c, 200, keys, gin.H{"pagination": newPagination(total, page)})
+}
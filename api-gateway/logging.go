@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// initLogging switches the process to structured JSON logs at the level named
+// by LOG_LEVEL (debug, info, warn or error; default info). Because slog's
+// default logger also backs the standard log package, existing log.Printf
+// calls are emitted as JSON too, at info.
+//
+// Fields named in LOG_REDACT_FIELDS, and always the Authorization and
+// X-API-Key headers, are logged as "***"; see redactAttr.
+//
+// Gin's own debug output is only wanted at debug, so above that Gin is put in
+// release mode unless GIN_MODE says otherwise.
+func initLogging() {
+	level, err := parseLogLevel(getEnv("LOG_LEVEL", "info"))
+	for _, name := range strings.Split(getEnv("LOG_REDACT_FIELDS", ""), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			redactedFields[redactKey(name)] = true
+		}
+	}
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, opts)).With("service", "api-gateway"))
+	if err != nil {
+		slog.Warn("Invalid LOG_LEVEL, using info", "error", err)
+	}
+
+	if os.Getenv("GIN_MODE") == "" {
+		if level > slog.LevelDebug {
+			gin.SetMode(gin.ReleaseMode)
+		} else {
+			gin.SetMode(gin.DebugMode)
+		}
+	}
+}
+
+// parseLogLevel accepts the slog level names, case-insensitively.
+func parseLogLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q", s)
+	}
+	return level, nil
+}
+
+// redactedFields holds the redactKey of every field and header name whose
+// value is never logged.
+var redactedFields = map[string]bool{"authorization": true, "x_api_key": true}
+
+// redactKey folds case and treats - and _ alike, so one entry covers both a
+// header (X-API-Key) and a field spelled after it (x_api_key).
+func redactKey(name string) string {
+	return strings.ReplaceAll(strings.ToLower(name), "-", "_")
+}
+
+// redactAttr is the handler's ReplaceAttr hook, so it applies to every log
+// line, request and error alike. Besides attributes (at any group depth) it
+// masks matching keys inside logged headers and maps such as gin.H details.
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if redactedFields[redactKey(a.Key)] {
+		return slog.String(a.Key, "***")
+	}
+	if a.Value.Kind() != slog.KindAny {
+		return a
+	}
+	switch v := a.Value.Any().(type) {
+	case http.Header:
+		masked := make(http.Header, len(v))
+		for k, vals := range v {
+			if redactedFields[redactKey(k)] {
+				vals = []string{"***"}
+			}
+			masked[k] = vals
+		}
+		return slog.Any(a.Key, masked)
+	case gin.H:
+		return slog.Any(a.Key, gin.H(redactMap(v)))
+	case map[string]any:
+		return slog.Any(a.Key, redactMap(v))
+	}
+	return a
+}
+
+func redactMap(m map[string]any) map[string]any {
+	masked := make(map[string]any, len(m))
+	for k, v := range m {
+		if redactedFields[redactKey(k)] {
+			v = "***"
+		}
+		masked[k] = v
+	}
+	return masked
+}
+
+// quietRoutes are polled by orchestrators and scrapers; their request lines
+// are logged at debug so they don't drown out real traffic.
+var quietRoutes = map[string]bool{"/health": true, "/health/live": true, "/health/ready": true, "/metrics": true}
+
+// requestIDMiddleware assigns every request an ID (honoring an incoming
+// X-Request-ID), echoes it back in the response, and logs one structured line
+// per request once the handler chain has finished.
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader("X-Request-ID")
+		if requestID == "" || len(requestID) > 128 {
+			requestID = newRequestID()
+		}
+		c.Set("request_id", requestID)
+		c.Header("X-Request-ID", requestID)
+
+		start := time.Now()
+		c.Next()
+
+		level := slog.LevelInfo
+		if quietRoutes[c.FullPath()] {
+			level = slog.LevelDebug
+		}
+		attrs := []any{"request_id", requestID}
+		if span := trace.SpanContextFromContext(c.Request.Context()); span.IsValid() {
+			attrs = append(attrs, "trace_id", span.TraceID().String())
+		}
+		// Headers only at debug, where redactAttr masks the credentials
+		if slog.Default().Enabled(c.Request.Context(), slog.LevelDebug) {
+			attrs = append(attrs, "headers", c.Request.Header)
+		}
+		slog.Log(c.Request.Context(), level, "request", append(attrs,
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"route", c.FullPath(),
+			"status", c.Writer.Status(),
+			"latency_ms", float64(time.Since(start).Microseconds())/1000,
+			"client_ip", c.ClientIP(),
+		)...)
+	}
+}
+
+// requestLog returns a logger tagged with the current request's ID so handler
+// errors can be correlated with the request log line.
+func requestLog(c *gin.Context) *slog.Logger {
+	return slog.With("request_id", c.GetString("request_id"))
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// purgeBatchSize bounds how many rows each DELETE removes, so no single
+	// statement holds its locks for long.
+	purgeBatchSize = 5000
+
+	minPurgeAge = time.Hour
+)
+
+// purgeTables lists what purgeOldRecords deletes, in order, with the column
+// that dates each row. Alerts go first so they are counted here rather than
+// removed silently by the cascade from threats.
+var purgeTables = []struct {
+	table, column string
+}{
+	{"alerts", "created_at"},
+	{"threats", "created_at"},
+	{"traffic", "received_at"},
+}
+
+// parseRetention accepts a Go duration ("36h") or a whole number of days
+// ("30d").
+func parseRetention(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
+
+// PurgeResult reports the cutoff of a purge and the rows deleted per table.
+type PurgeResult struct {
+	Cutoff  time.Time        `json:"cutoff"`
+	Deleted map[string]int64 `json:"deleted"`
+}
+
+// purgeOldRecords deletes the tenant's alerts, threats and traffic older than
+// ?older_than= and reports how many rows went from each table.
+func purgeOldRecords(c *gin.Context) {
+	v := c.Query("older_than")
+	if v == "" {
+		c.JSON(400, gin.H{"error": "older_than is required, e.g. older_than=30d"})
+		return
+	}
+	age, err := parseRetention(v)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error() + ": use e.g. 30d or 36h"})
+		return
+	}
+	if age < minPurgeAge {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("older_than must be at least %s", minPurgeAge)})
+		return
+	}
+
+	// Columns are TIMESTAMP without time zone and written in UTC.
+	cutoff := time.Now().UTC().Add(-age)
+	tenant := tenantFromContext(c)
+	deleted := map[string]int64{}
+	for _, t := range purgeTables {
+		n, err := purgeTable(c.Request.Context(), t.table, t.column, tenant, cutoff)
+		deleted[t.table] = n
+		if err != nil {
+			requestLog(c).Error("Failed to purge old records", "table", t.table, "deleted", n, "error", err)
+			internalError(c, fmt.Sprintf("failed to purge %s after deleting %d rows", t.table, n))
+			return
+		}
+	}
+
+	requestLog(c).Info("Purged old records", "tenant_id", tenant, "cutoff", cutoff, "actor", actorFromContext(c), "deleted", deleted)
+	recordAdminAction(c, "purge", nil, gin.H{"cutoff": cutoff, "deleted": deleted})
+	respond(c, 200, PurgeResult{Cutoff: cutoff, Deleted: deleted}, nil)
+}
+
+// purgeTable deletes matching rows purgeBatchSize at a time until none are
+// left, returning the total removed. Each batch commits on its own, so an
+// interrupted purge keeps what it already deleted and can simply be rerun.
+func purgeTable(ctx context.Context, table, column, tenant string, cutoff time.Time) (int64, error) {
+	query := fmt.Sprintf(`DELETE FROM %[1]s WHERE id IN (
+			SELECT id FROM %[1]s WHERE tenant_id = $1 AND %[2]s < $2 LIMIT $3
+		)`, table, column)
+
+	var total int64
+	for {
+		result, err := db.ExecContext(ctx, query, tenant, cutoff, purgeBatchSize)
+		if err != nil {
+			return total, err
+		}
+		n, _ := result.RowsAffected()
+		total += n
+		if n < purgeBatchSize {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,16 @@
+-- Threat Audit Table (verdict changes from re-analysis and committed replays)
+CREATE TABLE IF NOT EXISTS threat_audit (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    threat_id UUID NOT NULL REFERENCES threats(id) ON DELETE CASCADE,
+    action VARCHAR(20) NOT NULL, -- 'reanalysis', 'replay'
+    old_label VARCHAR(20) NOT NULL,
+    new_label VARCHAR(20) NOT NULL,
+    old_threat_type VARCHAR(50),
+    new_threat_type VARCHAR(50),
+    old_confidence FLOAT NOT NULL,
+    new_confidence FLOAT NOT NULL,
+    changed_by VARCHAR(100) NOT NULL,
+    changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_threat_audit_threat_id ON threat_audit(threat_id, changed_at);
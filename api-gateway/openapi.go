@@ -0,0 +1,520 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiDoc documents one /api/v1 operation for the OpenAPI document. Request
+// and response schemas are derived by reflection from the structs the handlers
+// actually bind and return, so field changes show up without editing this
+// file.
+type apiDoc struct {
+	Summary string
+	Scope   string
+	Query   []apiParam
+	// Body is a zero value of the request struct, or nil.
+	Body interface{}
+	// Status is the success status; 200 when zero.
+	Status int
+	// Response lists the top-level fields of the JSON response with zero
+	// values of their types: "data" plus any metadata respond puts next to
+	// it. Nil means the response has no JSON body.
+	Response apiFields
+	// ContentType overrides application/json for non-JSON responses.
+	ContentType string
+}
+
+type apiParam struct {
+	Name        string
+	Description string
+}
+
+type apiFields map[string]interface{}
+
+// Pagination documents the gin.H built by newPagination.
+type Pagination struct {
+	Total      int `json:"total"`
+	Page       int `json:"page"`
+	Limit      int `json:"limit"`
+	TotalPages int `json:"total_pages"`
+}
+
+var pageParams = []apiParam{
+	{"page", "Page number, starting at 1"},
+	{"limit", "Page size, from 1 to the maximum"},
+}
+
+var alertFilterParams = []apiParam{
+	{"severity", "Only alerts with this severity"},
+	{"status", "Only alerts with this status"},
+	{"assigned_to", "Only alerts assigned to this analyst"},
+	{"unassigned", "true for alerts nobody is assigned to; overrides assigned_to"},
+	{"q", "Case-insensitive substring match over description, notes and addresses"},
+	{"include_deleted", "true to include soft-deleted alerts"},
+}
+
+var sinceParam = apiParam{"since", "RFC3339 lower bound, at most STATS_MAX_DAYS in the past; default STATS_MAX_DAYS back"}
+var daysParam = apiParam{"days", "Window in days (default 7, at most STATS_MAX_DAYS)"}
+
+// apiDocs is keyed by "METHOD /path" as registered with Gin. Routes missing
+// here are still listed in the document, with their handler name as summary.
+var apiDocs = map[string]apiDoc{
+	"GET /api/v1/alerts": {
+		Summary: "List alerts, newest first", Scope: "read",
+		Query:    append(append([]apiParam{{"cursor", "Keyset cursor from next_cursor; replaces page"}}, pageParams...), alertFilterParams...),
+		Response: apiFields{"data": []Alert{}, "pagination": Pagination{}},
+	},
+	"GET /api/v1/alerts/stream": {
+		Summary: "WebSocket stream of new alerts", Scope: "read",
+		Query: []apiParam{{"severity", "Minimum severity"}},
+	},
+	"GET /api/v1/alerts/events": {
+		Summary: "Server-Sent Events stream of new alerts; Last-Event-ID replays missed ones", Scope: "read",
+		Query: []apiParam{{"severity", "Minimum severity"}}, ContentType: "text/event-stream",
+	},
+	"GET /api/v1/alerts/export": {
+		Summary: "Export alerts matching the list filters", Scope: "read",
+		Query: append([]apiParam{{"format", "csv (default) or json"}}, alertFilterParams...), ContentType: "text/csv",
+	},
+	"GET /api/v1/alerts/recent": {
+		Summary: "Alerts created after a cursor, oldest first, for incremental polling", Scope: "read",
+		Query: append([]apiParam{
+			{"after", "next_cursor of the previous call or an RFC3339 timestamp; omit for the newest alerts"},
+			{"limit", "Maximum alerts returned (default 100, at most 500)"},
+		}, alertFilterParams...),
+		Response: apiFields{"data": []Alert{}, "next_cursor": "", "has_more": false},
+	},
+	"GET /api/v1/alerts/count": {
+		Summary: "Number of alerts matching the list filters, cached briefly", Scope: "read",
+		Query: alertFilterParams, Response: apiFields{"data": AlertCount{}},
+	},
+	"GET /api/v1/alerts/facets": {
+		Summary: "Distinct severities, statuses and threat types of live alerts, with counts", Scope: "read",
+		Query: []apiParam{sinceParam}, Response: apiFields{"data": AlertFacets{}, "since": time.Time{}},
+	},
+	"GET /api/v1/alerts/:id": {
+		Summary: "Fetch an alert; supports If-None-Match", Scope: "read",
+		Response: apiFields{"data": Alert{}},
+	},
+	"PATCH /api/v1/alerts/:id": {
+		Summary: "Update an alert's status, severity, notes or assignee", Scope: "write",
+		Body: UpdateAlertRequest{}, Response: apiFields{"data": Alert{}},
+	},
+	"DELETE /api/v1/alerts/:id": {
+		Summary: "Soft-delete an alert", Scope: "write", Status: 204,
+	},
+	"POST /api/v1/alerts/:id/restore": {
+		Summary: "Restore a soft-deleted alert", Scope: "write",
+		Response: apiFields{"data": Alert{}},
+	},
+	"POST /api/v1/alerts/batch-get": {
+		Summary: "Fetch several alerts by id", Scope: "read",
+		Body: BatchGetAlertsRequest{}, Response: apiFields{"data": []Alert{}, "not_found": []string{}},
+	},
+	"POST /api/v1/alerts/bulk-update": {
+		Summary: "Set the status of several alerts", Scope: "write",
+		Body: BulkUpdateAlertsRequest{}, Response: apiFields{"data": BulkUpdateResult{}},
+	},
+	"POST /api/v1/alerts/:id/escalate": {
+		Summary: "Raise an alert's severity by one level", Scope: "write",
+		Response: apiFields{"data": Alert{}, "old_severity": "", "new_severity": ""},
+	},
+	"POST /api/v1/alerts/:id/snooze": {
+		Summary: "Mute new alerts from this alert's source for a while; they are raised acknowledged", Scope: "write",
+		Body: SnoozeAlertRequest{}, Response: apiFields{"data": Snooze{}},
+	},
+	"DELETE /api/v1/alerts/:id/snooze": {
+		Summary: "Lift the snooze on this alert's source", Scope: "write", Status: 204,
+	},
+	"GET /api/v1/alerts/snoozes": {
+		Summary: "Active snoozes, ending soonest first", Scope: "read",
+		Query: pageParams, Response: apiFields{"data": []Snooze{}, "pagination": Pagination{}},
+	},
+	"GET /api/v1/alerts/:id/history": {
+		Summary: "Audit history of an alert", Scope: "read",
+		Response: apiFields{"data": []AlertAuditEntry{}},
+	},
+	"POST /api/v1/incidents": {
+		Summary: "Group alerts into a new incident", Scope: "write", Status: 201,
+		Body: CreateIncidentRequest{}, Response: apiFields{"data": Incident{}, "alerts": []Alert{}},
+	},
+	"GET /api/v1/incidents/:id": {
+		Summary: "Fetch an incident with its alerts", Scope: "read",
+		Response: apiFields{"data": Incident{}, "alerts": []Alert{}},
+	},
+	"GET /api/v1/stats": {
+		Summary: "Threat and traffic totals", Scope: "read",
+		Query: []apiParam{sinceParam}, Response: apiFields{"data": Stats{}, "since": time.Time{}},
+	},
+	"GET /api/v1/stats/summary": {
+		Summary: "Totals, daily trend and top threat types in one call", Scope: "read",
+		Response: apiFields{"data": StatsSummary{}, "since": time.Time{}},
+	},
+	"GET /api/v1/stats/daily": {
+		Summary: "Daily threat and normal counts", Scope: "read",
+		Query: []apiParam{daysParam}, Response: apiFields{"data": []DailyStat{}, "days": 0},
+	},
+	"GET /api/v1/stats/daily/by-type": {
+		Summary: "Daily threat counts per threat type", Scope: "read",
+		Query:    []apiParam{daysParam},
+		Response: apiFields{"data": []DailyTypeStat{}, "days": 0, "threat_types": []string{}},
+	},
+	"GET /api/v1/stats/top-threats": {
+		Summary: "Most common threat types", Scope: "read",
+		Query: []apiParam{{"limit", "Number of types"}, sinceParam}, Response: apiFields{"data": []ThreatTypeCount{}, "since": time.Time{}},
+	},
+	"GET /api/v1/stats/compare": {
+		Summary: "Threat and alert counts of the current window and the one before it, with the change in percent", Scope: "read",
+		Query: []apiParam{
+			{"current", "Length of the current window ending now, e.g. 7d or 12h (default 7d)"},
+			{"previous", "Length of the window before it (default the same as current)"},
+		},
+		Response: apiFields{"data": StatsComparison{}},
+	},
+	"GET /api/v1/stats/heatmap": {
+		Summary: "Alert counts by weekday (0 = Sunday) and hour", Scope: "read",
+		Query:    []apiParam{daysParam, {"tz", "IANA time zone (default UTC)"}},
+		Response: apiFields{"data": [7][24]int{}, "days": 0, "tz": ""},
+	},
+	"GET /api/v1/stats/source/:ip": {
+		Summary: "Threat statistics for one source IP", Scope: "read",
+		Query: []apiParam{sinceParam}, Response: apiFields{"data": SourceStats{}, "since": time.Time{}},
+	},
+	"GET /api/v1/threats": {
+		Summary: "List threats", Scope: "read",
+		Query: append(append([]apiParam{}, pageParams...),
+			apiParam{"sort", "confidence (default) or recent"},
+			apiParam{"type", "Only this threat type"},
+			apiParam{"min_confidence", "Minimum confidence, 0-1"},
+			apiParam{"source_ip", "Only threats from this source"},
+			apiParam{"country", "ISO 3166-1 alpha-2 country of the source traffic"}),
+		Response: apiFields{"data": []Threat{}, "pagination": Pagination{}},
+	},
+	"GET /api/v1/threats/by-source": {
+		Summary: "Threat counts grouped by source IP", Scope: "read",
+		Query:    append(append([]apiParam{}, pageParams...), sinceParam),
+		Response: apiFields{"data": []SourceSummary{}, "pagination": Pagination{}, "since": time.Time{}},
+	},
+	"GET /api/v1/threats/timeseries": {
+		Summary: "Malicious and suspicious threat counts per hour, day or week, zero-filled", Scope: "read",
+		Query: []apiParam{
+			{"granularity", "hour, day (default) or week"},
+			{"since", "RFC3339 start, at most STATS_MAX_DAYS in the past; default 30 buckets back"},
+		},
+		Response: apiFields{"data": []ThreatBucket{}, "granularity": "", "since": time.Time{}},
+	},
+	"GET /api/v1/threats/:id": {
+		Summary: "Fetch a threat with its alerts; supports If-None-Match", Scope: "read",
+		Response: apiFields{"data": Threat{}, "alerts": []Alert{}},
+	},
+	"GET /api/v1/threats/:id/timeline": {
+		Summary: "Threat creation, verdict changes and related alert events, oldest first", Scope: "read",
+		Response: apiFields{"data": []TimelineEvent{}},
+	},
+	"GET /api/v1/threats/:id/traffic": {
+		Summary: "Raw traffic record the threat was scored from, with all stored fields", Scope: "forensics",
+		Response: apiFields{"data": []RawTraffic{}},
+	},
+	"POST /api/v1/threats/:id/reanalyze": {
+		Summary: "Re-score a threat's traffic with the current rules", Scope: "write",
+		Response: apiFields{"data": Threat{}, "before": Verdict{}, "after": Verdict{}, "matched_rules": []MatchedRule{}},
+	},
+	"POST /api/v1/analyze": {
+		Summary: "Score a traffic sample and persist the verdict", Scope: "write", Status: 201,
+		Body: AnalyzeRequest{},
+		Response: apiFields{"score": 0.0, "label": "", "threat_type": (*string)(nil), "matched_rules": []MatchedRule{},
+			"feedback_weight": 0.0, "data": Threat{}, "alert": (*Alert)(nil), "correlated": false, "snoozed": false},
+	},
+	"POST /api/v1/analyze/batch": {
+		Summary: "Score an array of traffic samples and persist the verdicts in one transaction", Scope: "write",
+		Body:     []AnalyzeRequest{},
+		Response: apiFields{"data": []BatchVerdict{}, "analyzed": 0, "failed": 0},
+	},
+	"GET /api/v1/feedback": {
+		Summary: "Signatures marked false positive and the score weight applied to new matches", Scope: "read",
+		Query: pageParams, Response: apiFields{"data": []Feedback{}, "pagination": Pagination{}},
+	},
+	"GET /api/v1/rules": {
+		Summary: "List scoring rules", Scope: "read",
+		Query: pageParams, Response: apiFields{"data": []Rule{}, "pagination": Pagination{}},
+	},
+	"PATCH /api/v1/rules/:id": {
+		Summary: "Enable or disable a scoring rule (all tenants)", Scope: "admin",
+		Body: UpdateRuleRequest{}, Response: apiFields{"data": Rule{}},
+	},
+	"GET /api/v1/ip-lists": {
+		Summary: "List allow/deny list entries", Scope: "read",
+		Query:    append(append([]apiParam{}, pageParams...), apiParam{"list_type", "allow or deny"}),
+		Response: apiFields{"data": []IPListEntry{}, "pagination": Pagination{}},
+	},
+	"POST /api/v1/ip-lists": {
+		Summary: "Add an allow/deny list entry", Scope: "admin", Status: 201,
+		Body: CreateIPListEntryRequest{}, Response: apiFields{"data": IPListEntry{}},
+	},
+	"DELETE /api/v1/ip-lists/:id": {
+		Summary: "Remove an allow/deny list entry", Scope: "admin", Status: 204,
+	},
+	"POST /api/v1/analyze/replay": {
+		Summary: "Re-score stored traffic with the current rules and report verdict changes", Scope: "admin",
+		Query: []apiParam{
+			{"since", "RFC3339 start of the traffic to replay (required), at most STATS_MAX_DAYS in the past"},
+			{"commit", "true to rewrite the changed threats; otherwise a dry run"},
+		},
+		Response: apiFields{"data": ReplayReport{}},
+	},
+	"DELETE /api/v1/maintenance/purge": {
+		Summary: "Delete alerts, threats and traffic older than a cutoff", Scope: "admin",
+		Query:    []apiParam{{"older_than", "Age such as 30d or 36h (required)"}},
+		Response: apiFields{"data": PurgeResult{}},
+	},
+	"GET /api/v1/admin/keys/usage": {
+		Summary: "API keys with request counts and last use", Scope: "admin",
+		Query: pageParams, Response: apiFields{"data": []KeyUsage{}, "pagination": Pagination{}},
+	},
+	"POST /api/v1/admin/keys/:id/rotate": {
+		Summary: "Replace a key's secret; the new one is only shown in this response", Scope: "admin",
+		Query:    []apiParam{{"grace_period", "How long the old secret keeps working, e.g. 24h or 2d (at most 7d)"}},
+		Response: apiFields{"data": RotatedKey{}},
+	},
+	"GET /api/v1/audit/export": {
+		Summary: "Stream alert audit records and admin actions as JSON lines, oldest first", Scope: "admin",
+		Query: []apiParam{
+			{"since", "RFC3339 inclusive lower bound"},
+			{"until", "RFC3339 exclusive upper bound"},
+		},
+		ContentType: "application/x-ndjson",
+	},
+	"GET /api/v1/webhooks": {
+		Summary: "List alert webhooks", Scope: "read",
+		Query: pageParams, Response: apiFields{"data": []Webhook{}, "pagination": Pagination{}},
+	},
+	"POST /api/v1/webhooks": {
+		Summary: "Register an alert webhook", Scope: "write", Status: 201,
+		Body: CreateWebhookRequest{}, Response: apiFields{"data": Webhook{}},
+	},
+	"DELETE /api/v1/webhooks/:id": {
+		Summary: "Delete an alert webhook", Scope: "write", Status: 204,
+	},
+}
+
+var pathParamPattern = regexp.MustCompile(`:([A-Za-z_]+)`)
+
+// buildOpenAPISpec renders an OpenAPI 3 document for the router's /api/v1
+// routes.
+func buildOpenAPISpec(routes gin.RoutesInfo) gin.H {
+	schemas := openAPISchemas{}
+	paths := gin.H{}
+	for _, r := range routes {
+		if !strings.HasPrefix(r.Path, "/api/v1/") {
+			continue
+		}
+		doc, ok := apiDocs[r.Method+" "+r.Path]
+		if !ok {
+			doc.Summary = r.Handler[strings.LastIndex(r.Handler, ".")+1:]
+		}
+
+		op := gin.H{
+			"summary":    doc.Summary,
+			"parameters": routeParams(r.Path, doc.Query),
+			"responses":  schemas.responses(doc),
+		}
+		if doc.Scope != "" {
+			op["description"] = "Requires the `" + doc.Scope + "` scope."
+		}
+		if doc.Body != nil {
+			op["requestBody"] = gin.H{
+				"required": true,
+				"content":  gin.H{"application/json": gin.H{"schema": schemas.of(reflect.TypeOf(doc.Body))}},
+			}
+		}
+
+		path := pathParamPattern.ReplaceAllString(r.Path, "{$1}")
+		item, _ := paths[path].(gin.H)
+		if item == nil {
+			item = gin.H{}
+			paths[path] = item
+		}
+		item[strings.ToLower(r.Method)] = op
+	}
+
+	schemas["Error"] = gin.H{
+		"type":       "object",
+		"properties": gin.H{"error": gin.H{"type": "string"}},
+	}
+	return gin.H{
+		"openapi": "3.0.3",
+		"info": gin.H{
+			"title":   "Threat Detector API Gateway",
+			"version": "1.0.0",
+			"description": "Successful JSON responses are an envelope: `data` holds the payload and any other " +
+				"top-level fields describe the request (pagination, report window, ...). Send " +
+				"`X-Response-Format: raw` or `?envelope=false` to receive only the payload; paginated " +
+				"lists still carry `Link` and `X-Total-Count` headers. Errors are `{\"error\": \"...\"}`.",
+		},
+		"paths": paths,
+		"components": gin.H{
+			"schemas": schemas,
+			"securitySchemes": gin.H{
+				"apiKey": gin.H{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+				"bearer": gin.H{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+		"security": []gin.H{{"apiKey": []string{}}, {"bearer": []string{}}},
+	}
+}
+
+func routeParams(path string, query []apiParam) []gin.H {
+	params := []gin.H{}
+	for _, m := range pathParamPattern.FindAllStringSubmatch(path, -1) {
+		params = append(params, gin.H{"name": m[1], "in": "path", "required": true, "schema": gin.H{"type": "string"}})
+	}
+	for _, q := range query {
+		params = append(params, gin.H{"name": q.Name, "in": "query", "description": q.Description, "schema": gin.H{"type": "string"}})
+	}
+	return params
+}
+
+// openAPISchemas collects the named struct schemas referenced by the document.
+type openAPISchemas gin.H
+
+func (s openAPISchemas) responses(doc apiDoc) gin.H {
+	status := doc.Status
+	if status == 0 {
+		status = 200
+	}
+	success := gin.H{"description": "Success"}
+	switch {
+	case doc.ContentType != "":
+		success["content"] = gin.H{doc.ContentType: gin.H{}}
+	case doc.Response != nil:
+		names := make([]string, 0, len(doc.Response))
+		for name := range doc.Response {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		props := gin.H{}
+		for _, name := range names {
+			props[name] = s.of(reflect.TypeOf(doc.Response[name]))
+		}
+		success["content"] = gin.H{"application/json": gin.H{"schema": gin.H{"type": "object", "properties": props}}}
+	}
+	errorBody := gin.H{"application/json": gin.H{"schema": gin.H{"$ref": "#/components/schemas/Error"}}}
+	return gin.H{
+		strconv.Itoa(status): success,
+		"default":            gin.H{"description": "Error", "content": errorBody},
+	}
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// of returns the schema for t. Named structs are added to the components
+// section once and referenced from there.
+func (s openAPISchemas) of(t reflect.Type) gin.H {
+	switch {
+	case t == timeType:
+		return gin.H{"type": "string", "format": "date-time"}
+	case t == rawType:
+		return gin.H{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := gin.H{}
+		for k, v := range s.of(t.Elem()) {
+			schema[k] = v
+		}
+		if _, isRef := schema["$ref"]; isRef {
+			return gin.H{"allOf": []gin.H{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.String:
+		return gin.H{"type": "string"}
+	case reflect.Bool:
+		return gin.H{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return gin.H{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return gin.H{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return gin.H{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return gin.H{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Map:
+		return gin.H{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		if _, done := s[t.Name()]; !done {
+			s[t.Name()] = gin.H{} // placeholder for recursive types
+			s[t.Name()] = s.object(t)
+		}
+		return gin.H{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return gin.H{}
+}
+
+// object describes a struct by its JSON field names. Fields bound with
+// `binding:"required"` are listed as required.
+func (s openAPISchemas) object(t reflect.Type) gin.H {
+	props := gin.H{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = s.of(f.Type)
+		if strings.Contains(f.Tag.Get("binding"), "required") {
+			required = append(required, name)
+		}
+	}
+	schema := gin.H{"type": "object", "properties": props}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// serveOpenAPI serves the document built at startup.
+func serveOpenAPI(spec gin.H) gin.HandlerFunc {
+	payload, _ := json.Marshal(spec)
+	return func(c *gin.Context) {
+		c.Data(200, "application/json; charset=utf-8", payload)
+	}
+}
+
+// swaggerUIPage renders /openapi.json with Swagger UI loaded from a CDN.
+const swaggerUIPage = `<!DOCTYPE html>
+<html>
+<head>
+  <title>Threat Detector API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+func serveSwaggerUI(c *gin.Context) {
+	c.Data(200, "text/html; charset=utf-8", []byte(swaggerUIPage))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+
+	// maxPageNumber keeps OFFSET well inside int range; nobody pages this far
+	// by hand, and deep scans should use the alert cursor instead.
+	maxPageNumber = 1_000_000
+)
+
+// pageSpec describes the paging a list endpoint accepts. Sorts lists the
+// allowed ?sort= values with the default first; it is nil for endpoints with
+// a fixed order.
+type pageSpec struct {
+	DefaultLimit int
+	MaxLimit     int
+	Sorts        []string
+}
+
+// defaultPageSpec is used by the lists that have no paging needs of their own.
+var defaultPageSpec = pageSpec{DefaultLimit: defaultPageLimit, MaxLimit: maxPageLimit}
+
+// Page is a validated ?page=, ?limit= and ?sort= combination.
+type Page struct {
+	Number int
+	Limit  int
+	Sort   string
+}
+
+// Offset is the number of rows before this page.
+func (p Page) Offset() int {
+	return (p.Number - 1) * p.Limit
+}
+
+// parsePage reads the paging params according to spec. Missing values fall
+// back to defaults; anything non-numeric, below 1 or above its maximum
+// (maxPageNumber, spec.MaxLimit) is an error suitable for a 400 response, so
+// a client never gets fewer rows than it asked for without noticing.
+func parsePage(c *gin.Context, spec pageSpec) (Page, error) {
+	p := Page{Number: 1, Limit: spec.DefaultLimit}
+	if len(spec.Sorts) > 0 {
+		p.Sort = spec.Sorts[0]
+	}
+
+	if v := c.Query("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageNumber {
+			return Page{}, fmt.Errorf("invalid page %q: must be an integer between 1 and %d", v, maxPageNumber)
+		}
+		p.Number = n
+	}
+
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > spec.MaxLimit {
+			return Page{}, fmt.Errorf("invalid limit %q: must be an integer between 1 and %d", v, spec.MaxLimit)
+		}
+		p.Limit = n
+	}
+
+	if v := c.Query("sort"); v != "" {
+		if !contains(spec.Sorts, v) {
+			if len(spec.Sorts) == 0 {
+				return Page{}, fmt.Errorf("invalid sort %q: this list can't be sorted", v)
+			}
+			return Page{}, fmt.Errorf("invalid sort %q: must be one of %s", v, strings.Join(spec.Sorts, ", "))
+		}
+		p.Sort = v
+	}
+
+	return p, nil
+}
+
+func newPagination(total int, p Page) gin.H {
+	return gin.H{
+		"total":       total,
+		"page":        p.Number,
+		"limit":       p.Limit,
+		"total_pages": (total + p.Limit - 1) / p.Limit,
+	}
+}
+
+// setPageLinks sets an RFC 8288 Link header with first, prev, next and last
+// relations for an offset-paginated list, and X-Total-Count, mirroring the
+// pagination object for raw responses.
+func setPageLinks(c *gin.Context, total int, p Page) {
+	last := (total + p.Limit - 1) / p.Limit
+	if last < 1 {
+		last = 1
+	}
+	links := []string{pageLink(c, "page", "1", "first")}
+	if p.Number > 1 {
+		links = append(links, pageLink(c, "page", strconv.Itoa(min(p.Number-1, last)), "prev"))
+	}
+	if p.Number < last {
+		links = append(links, pageLink(c, "page", strconv.Itoa(p.Number+1), "next"))
+	}
+	links = append(links, pageLink(c, "page", strconv.Itoa(last), "last"))
+	c.Header("Link", strings.Join(links, ", "))
+	c.Header("X-Total-Count", strconv.Itoa(total))
+}
+
+// pageLink renders one Link header entry pointing at the current request with
+// param set to value. Every other query parameter, filters included, is kept.
+func pageLink(c *gin.Context, param, value, rel string) string {
+	query := c.Request.URL.Query()
+	query.Set(param, value)
+	u := url.URL{Path: c.Request.URL.Path, RawQuery: query.Encode()}
+	return fmt.Sprintf("<%s>; rel=%q", u.String(), rel)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func pageContext(query string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/api/v1/threats?"+query, nil)
+	return c
+}
+
+func TestParsePage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	spec := pageSpec{DefaultLimit: 50, MaxLimit: 200, Sorts: []string{"confidence", "recent"}}
+
+	tests := []struct {
+		query   string
+		want    Page
+		wantErr bool
+	}{
+		{query: "", want: Page{Number: 1, Limit: 50, Sort: "confidence"}},
+		{query: "page=3&limit=20&sort=recent", want: Page{Number: 3, Limit: 20, Sort: "recent"}},
+		{query: "page=1000000&limit=200", want: Page{Number: 1000000, Limit: 200, Sort: "confidence"}},
+
+		// negative
+		{query: "page=-1", wantErr: true},
+		{query: "limit=-5", wantErr: true},
+		// zero
+		{query: "page=0", wantErr: true},
+		{query: "limit=0", wantErr: true},
+		// overflow: past the maximum, and past the int range
+		{query: "page=1000001", wantErr: true},
+		{query: "limit=201", wantErr: true},
+		{query: "page=99999999999999999999", wantErr: true},
+		{query: "limit=99999999999999999999", wantErr: true},
+		// non-numeric
+		{query: "page=abc", wantErr: true},
+		{query: "limit=ten", wantErr: true},
+		{query: "page=1.5", wantErr: true},
+		{query: "limit=1e2", wantErr: true},
+		// unknown sort
+		{query: "sort=name", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parsePage(pageContext(tt.query), spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parsePage(%q) = %+v, want an error", tt.query, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsePage(%q) returned error %v", tt.query, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parsePage(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParsePageWithoutSorts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	if _, err := parsePage(pageContext("sort=recent"), defaultPageSpec); err == nil {
+		t.Error("sort on a list without sorts was accepted")
+	}
+}
+
+func TestPageOffset(t *testing.T) {
+	if got := (Page{Number: 3, Limit: 20}).Offset(); got != 40 {
+		t.Errorf("Offset() = %d, want 40", got)
+	}
+}
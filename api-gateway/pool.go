@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// errPoolBusy is returned by workerPool.run when no worker frees up in time.
+var errPoolBusy = errors.New("worker pool busy")
+
+// workerPool runs functions on a fixed number of goroutines, bounding how much
+// CPU-heavy work happens at once no matter how many requests arrive.
+type workerPool struct {
+	jobs chan func()
+}
+
+func newWorkerPool(workers int) *workerPool {
+	p := &workerPool{jobs: make(chan func())}
+	for i := 0; i < max(workers, 1); i++ {
+		go func() {
+			for job := range p.jobs {
+				job()
+			}
+		}()
+	}
+	return p
+}
+
+// run hands fn to a worker and waits for it to finish. The jobs channel is
+// unbuffered, so callers queue by waiting for a free worker; if none frees up
+// within wait, run gives up with errPoolBusy. Once started, fn always runs to
+// completion.
+func (p *workerPool) run(ctx context.Context, wait time.Duration, fn func()) error {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	done := make(chan struct{})
+	job := func() {
+		defer close(done)
+		fn()
+	}
+	select {
+	case p.jobs <- job:
+	case <-timer.C:
+		return errPoolBusy
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	<-done
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/XSAM/otelsql"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// readReplica is one DATABASE_READ_URL pool and whether its last health
+// check succeeded.
+type readReplica struct {
+	name    string
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+var (
+	readReplicas    []*readReplica
+	readReplicaNext atomic.Uint64
+
+	readReplicaCheckInterval = 10 * time.Second
+)
+
+// initReadReplicas opens a pool per comma-separated DATABASE_READ_URL, sized
+// like the primary's. Replicas start out unhealthy until their first ping
+// succeeds, so reads stay on the primary until then. They don't go through
+// dbBreaker, which guards the primary: a bad replica is simply skipped.
+func initReadReplicas() {
+	for i, url := range strings.Split(os.Getenv("DATABASE_READ_URL"), ",") {
+		if url = strings.TrimSpace(url); url == "" {
+			continue
+		}
+		replica, err := otelsql.Open("postgres", url, otelsql.WithAttributes(semconv.DBSystemPostgreSQL))
+		if err != nil {
+			log.Fatalf("Failed to open read replica %d: %v", i, err)
+		}
+		replica.SetMaxOpenConns(getEnvInt("DB_MAX_OPEN_CONNS", 25))
+		replica.SetMaxIdleConns(getEnvInt("DB_MAX_IDLE_CONNS", 10))
+		replica.SetConnMaxLifetime(getEnvDuration("DB_CONN_MAX_LIFETIME", 30*time.Minute))
+		readReplicas = append(readReplicas, &readReplica{name: replicaName(url), db: replica})
+	}
+	if len(readReplicas) == 0 {
+		return
+	}
+	readReplicaCheckInterval = getEnvDuration("DB_READ_HEALTH_CHECK_INTERVAL", readReplicaCheckInterval)
+	checkReadReplicas(context.Background())
+	log.Printf("Using %d read replica(s), %d healthy", len(readReplicas), healthyReadReplicas())
+}
+
+func healthyReadReplicas() int {
+	n := 0
+	for _, r := range readReplicas {
+		if r.healthy.Load() {
+			n++
+		}
+	}
+	return n
+}
+
+// replicaName is the host part of a replica URL, for logs without the
+// credentials.
+func replicaName(url string) string {
+	if at := strings.LastIndex(url, "@"); at >= 0 {
+		url = url[at+1:]
+	}
+	url = strings.TrimPrefix(strings.TrimPrefix(url, "postgres://"), "postgresql://")
+	if end := strings.IndexAny(url, "/?"); end >= 0 {
+		url = url[:end]
+	}
+	return url
+}
+
+// readDB returns the pool for read-only queries that tolerate replication
+// lag, such as lists and stats: the healthy replicas in turn, or the primary
+// when none is configured or healthy. Reads that must see a write just made,
+// and everything inside a transaction, use db.
+func readDB() *sql.DB {
+	n := uint64(len(readReplicas))
+	if n == 0 {
+		return db
+	}
+	start := readReplicaNext.Add(1)
+	for i := uint64(0); i < n; i++ {
+		if r := readReplicas[(start+i)%n]; r.healthy.Load() {
+			return r.db
+		}
+	}
+	return db
+}
+
+// runReadReplicaChecks pings the replicas every DB_READ_HEALTH_CHECK_INTERVAL
+// until ctx is done.
+func runReadReplicaChecks(ctx context.Context) {
+	if len(readReplicas) == 0 {
+		return
+	}
+	ticker := time.NewTicker(readReplicaCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkReadReplicas(ctx)
+		}
+	}
+}
+
+func checkReadReplicas(ctx context.Context) {
+	for _, r := range readReplicas {
+		pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		err := r.db.PingContext(pingCtx)
+		cancel()
+		if was := r.healthy.Swap(err == nil); was != (err == nil) {
+			if err != nil {
+				slog.Warn("Read replica unhealthy, skipping it", "replica", r.name, "error", err)
+			} else {
+				slog.Info("Read replica healthy", "replica", r.name)
+			}
+		}
+	}
+}
+
+// closeReadReplicas closes the replica pools on shutdown.
+func closeReadReplicas() {
+	for _, r := range readReplicas {
+		r.db.Close()
+	}
+}
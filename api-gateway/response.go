@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Every successful /api/v1 JSON response is an envelope:
+//
+//	{"data": <payload>, ...metadata}
+//
+// where the payload is the resource, list or report asked for and metadata
+// (pagination, next_cursor, the window of a report, ...) describes the
+// request. Errors are {"error": "..."} either way.
+//
+// Clients that want only the payload send X-Response-Format: raw or
+// ?envelope=false. Metadata is then dropped, apart from what is also in
+// headers, such as the Link and X-Total-Count of paginated lists.
+
+// wantsRawResponse reports whether the client asked for the bare payload.
+func wantsRawResponse(c *gin.Context) bool {
+	return strings.EqualFold(c.GetHeader("X-Response-Format"), "raw") || c.Query("envelope") == "false"
+}
+
+// envelope returns the body respond writes for data and meta.
+func envelope(c *gin.Context, data any, meta gin.H) any {
+	if wantsRawResponse(c) {
+		return data
+	}
+	body := gin.H{"data": data}
+	for k, v := range meta {
+		body[k] = v
+	}
+	return body
+}
+
+// respond writes data as a JSON response in the standard envelope, with meta
+// alongside it, or data alone when the client asked for a raw response.
+func respond(c *gin.Context, code int, data any, meta gin.H) {
+	c.JSON(code, envelope(c, data, meta))
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	scoringRulesCacheKey = "scoring:rules"
+	scoringRulesCacheTTL = time.Minute
+)
+
+// RuleCondition compares one traffic field against a value. Value is a number,
+// or an array of numbers for the "in" operator.
+type RuleCondition struct {
+	Field    string          `json:"field"`
+	Operator string          `json:"operator"`
+	Value    json.RawMessage `json:"value"`
+}
+
+// Rule mirrors a row of the scoring_rules table.
+type Rule struct {
+	ID         string          `json:"id"`
+	Name       string          `json:"name"`
+	ThreatType string          `json:"threat_type"`
+	Conditions []RuleCondition `json:"conditions"`
+	Weight     float64         `json:"weight"`
+	IsActive   bool            `json:"is_active"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+const ruleColumns = `id, name, threat_type, conditions, weight, is_active, created_at, updated_at`
+
+func scanRule(s rowScanner) (Rule, error) {
+	var r Rule
+	var conditions []byte
+	if err := s.Scan(&r.ID, &r.Name, &r.ThreatType, &conditions, &r.Weight, &r.IsActive, &r.CreatedAt, &r.UpdatedAt); err != nil {
+		return r, err
+	}
+	return r, json.Unmarshal(conditions, &r.Conditions)
+}
+
+// ruleFields are the traffic fields a condition can refer to. The bool is
+// false when the sample doesn't carry the field, which fails the condition.
+var ruleFields = map[string]func(req AnalyzeRequest) (float64, bool){
+	"bytes":        func(req AnalyzeRequest) (float64, bool) { return float64(*req.Bytes), true },
+	"packet_count": func(req AnalyzeRequest) (float64, bool) { return float64(*req.PacketCount), true },
+	"duration":     func(req AnalyzeRequest) (float64, bool) { return durationOf(req), true },
+	"dest_port":    func(req AnalyzeRequest) (float64, bool) { return float64(*req.DestPort), true },
+	"source_port": func(req AnalyzeRequest) (float64, bool) {
+		if req.SourcePort == nil {
+			return 0, false
+		}
+		return float64(*req.SourcePort), true
+	},
+	"packet_rate": func(req AnalyzeRequest) (float64, bool) {
+		return float64(*req.PacketCount) / math.Max(durationOf(req), 1), true
+	},
+}
+
+var ruleOperators = map[string]func(a, b float64) bool{
+	"eq":  func(a, b float64) bool { return a == b },
+	"neq": func(a, b float64) bool { return a != b },
+	"gt":  func(a, b float64) bool { return a > b },
+	"gte": func(a, b float64) bool { return a >= b },
+	"lt":  func(a, b float64) bool { return a < b },
+	"lte": func(a, b float64) bool { return a <= b },
+}
+
+// compileCondition turns a stored condition into a predicate, rejecting
+// unknown fields and operators and values of the wrong shape.
+func compileCondition(cond RuleCondition) (func(AnalyzeRequest) bool, error) {
+	field, ok := ruleFields[cond.Field]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q", cond.Field)
+	}
+
+	if cond.Operator == "in" {
+		var values []float64
+		if err := json.Unmarshal(cond.Value, &values); err != nil {
+			return nil, fmt.Errorf("operator in on %s needs an array of numbers", cond.Field)
+		}
+		return func(req AnalyzeRequest) bool {
+			v, ok := field(req)
+			if !ok {
+				return false
+			}
+			for _, candidate := range values {
+				if v == candidate {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+
+	compare, ok := ruleOperators[cond.Operator]
+	if !ok {
+		return nil, fmt.Errorf("unknown operator %q", cond.Operator)
+	}
+	var value float64
+	if err := json.Unmarshal(cond.Value, &value); err != nil {
+		return nil, fmt.Errorf("operator %s on %s needs a number", cond.Operator, cond.Field)
+	}
+	return func(req AnalyzeRequest) bool {
+		v, ok := field(req)
+		return ok && compare(v, value)
+	}, nil
+}
+
+// compileRule builds a scoringRule that matches when all conditions do.
+func compileRule(r Rule) (scoringRule, error) {
+	if len(r.Conditions) == 0 {
+		return scoringRule{}, errors.New("rule has no conditions")
+	}
+	predicates := make([]func(AnalyzeRequest) bool, 0, len(r.Conditions))
+	for _, cond := range r.Conditions {
+		p, err := compileCondition(cond)
+		if err != nil {
+			return scoringRule{}, err
+		}
+		predicates = append(predicates, p)
+	}
+	return scoringRule{
+		name:       r.Name,
+		threatType: r.ThreatType,
+		weight:     r.Weight,
+		match: func(req AnalyzeRequest, _ ScoringConfig) bool {
+			for _, p := range predicates {
+				if !p(req) {
+					return false
+				}
+			}
+			return true
+		},
+	}, nil
+}
+
+// loadRules returns every row of scoring_rules, consulting Redis first.
+func loadRules(c *gin.Context) ([]Rule, error) {
+	ctx := c.Request.Context()
+	if cached, err := redisClient.Get(ctx, scoringRulesCacheKey).Bytes(); err == nil {
+		var rules []Rule
+		if err := json.Unmarshal(cached, &rules); err == nil {
+			return rules, nil
+		}
+	} else if err != redis.Nil {
+		requestLog(c).Warn("Failed to read scoring rules cache", "error", err)
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT "+ruleColumns+" FROM scoring_rules ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []Rule{}
+	for rows.Next() {
+		r, err := scanRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if payload, err := json.Marshal(rules); err == nil {
+		if err := redisClient.Set(ctx, scoringRulesCacheKey, payload, scoringRulesCacheTTL).Err(); err != nil {
+			requestLog(c).Warn("Failed to write scoring rules cache", "error", err)
+		}
+	}
+	return rules, nil
+}
+
+// activeScoringRules returns the compiled active rules from the database. The
+// built-in defaultScoringRules are used when the table is empty or can't be
+// read, so scoring keeps working without it. Invalid rules are skipped.
+func activeScoringRules(c *gin.Context) []scoringRule {
+	rules, err := loadRules(c)
+	if err != nil {
+		requestLog(c).Warn("Failed to load scoring rules, using built-in rules", "error", err)
+		return defaultScoringRules
+	}
+	if len(rules) == 0 {
+		return defaultScoringRules
+	}
+
+	compiled := make([]scoringRule, 0, len(rules))
+	for _, r := range rules {
+		if !r.IsActive {
+			continue
+		}
+		rule, err := compileRule(r)
+		if err != nil {
+			requestLog(c).Warn("Skipping invalid scoring rule", "rule", r.Name, "error", err)
+			continue
+		}
+		compiled = append(compiled, rule)
+	}
+	return compiled
+}
+
+func listRules(c *gin.Context) {
+	page, err := parsePage(c, defaultPageSpec)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	var total int
+	rdb := readDB()
+	if err := rdb.QueryRowContext(c.Request.Context(), "SELECT COUNT(*) FROM scoring_rules").Scan(&total); err != nil {
+		requestLog(c).Error("Failed to count scoring rules", "error", err)
+		internalError(c, "failed to fetch rules")
+		return
+	}
+
+	rows, err := rdb.QueryContext(c.Request.Context(), "SELECT "+ruleColumns+" FROM scoring_rules ORDER BY name LIMIT $1 OFFSET $2",
+		page.Limit, page.Offset())
+	if err != nil {
+		requestLog(c).Error("Failed to query scoring rules", "error", err)
+		internalError(c, "failed to fetch rules")
+		return
+	}
+	defer rows.Close()
+
+	rules := []Rule{}
+	for rows.Next() {
+		r, err := scanRule(rows)
+		if err != nil {
+			requestLog(c).Error("Failed to scan scoring rule", "error", err)
+			internalError(c, "failed to fetch rules")
+			return
+		}
+		rules = append(rules, r)
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(c).Error("Failed to iterate scoring rules", "error", err)
+		internalError(c, "failed to fetch rules")
+		return
+	}
+
+	setPageLinks(c, total, page)
+	respond(c, 200, rules, gin.H{"pagination": newPagination(total, page)})
+}
+
+// UpdateRuleRequest is the PATCH body for updateRule.
+type UpdateRuleRequest struct {
+	IsActive *bool `json:"is_active" binding:"required"`
+}
+
+// updateRule enables or disables a scoring rule. Rules are shared by every
+// tenant, so the route is admin-only and each toggle is audited. The change
+// takes effect on the next analysis, since the cached ruleset is dropped.
+func updateRule(c *gin.Context) {
+	id := c.Param("id")
+	if !isValidUUID(id) {
+		c.JSON(400, gin.H{"error": "invalid rule id"})
+		return
+	}
+
+	var req UpdateRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	rule, err := scanRule(db.QueryRowContext(ctx,
+		"UPDATE scoring_rules SET is_active = $1 WHERE id = $2 RETURNING "+ruleColumns, *req.IsActive, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"error": "rule not found"})
+		return
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to update scoring rule", "rule_id", id, "error", err)
+		internalError(c, "failed to update rule")
+		return
+	}
+
+	if err := redisClient.Del(ctx, scoringRulesCacheKey).Err(); err != nil {
+		requestLog(c).Warn("Failed to invalidate scoring rules cache", "error", err)
+	}
+	recordAdminAction(c, "rule_toggle", &id, gin.H{"name": rule.Name, "is_active": rule.IsActive})
+
+	respond(c, 200, rule, nil)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	sseKeepAliveInterval = 15 * time.Second
+
+	// sseReplayLimit caps how many missed alerts are replayed for a client
+	// resuming with Last-Event-ID.
+	sseReplayLimit = 500
+)
+
+// streamAlertEvents is the Server-Sent Events counterpart of streamAlerts for
+// clients behind proxies that block WebSockets. Each event's id is the alert
+// ID; a reconnecting client's Last-Event-ID replays the tenant's alerts
+// created after that one before switching to live events.
+func streamAlertEvents(c *gin.Context) {
+	tenant := tenantFromContext(c)
+	minSeverity := c.Query("severity")
+	if minSeverity != "" && !contains(validAlertSeverities, minSeverity) {
+		c.JSON(400, gin.H{"error": "invalid severity: must be one of low, medium, high, critical"})
+		return
+	}
+
+	// Subscribe before replaying so nothing published in between is lost;
+	// alerts seen during the replay are skipped when they arrive live.
+	sub, ok := alertStream.subscribe()
+	if !ok {
+		c.JSON(503, gin.H{"error": "too many concurrent alert streams"})
+		return
+	}
+	defer alertStream.unsubscribe(sub)
+
+	var missed []Alert
+	if lastID := c.GetHeader("Last-Event-ID"); isValidUUID(lastID) {
+		var err error
+		if missed, err = alertsAfter(c, tenant, lastID); err != nil {
+			requestLog(c).Error("Failed to replay alerts for event stream", "last_event_id", lastID, "error", err)
+			internalError(c, "failed to resume alert stream")
+			return
+		}
+	}
+
+	h := c.Writer.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no") // stop nginx from buffering the stream
+	c.Status(200)
+
+	send := func(id string, payload []byte) bool {
+		if _, err := fmt.Fprintf(c.Writer, "id: %s\nevent: alert\ndata: %s\n\n", id, payload); err != nil {
+			return false
+		}
+		c.Writer.Flush()
+		return true
+	}
+
+	replayed := make(map[string]bool, len(missed))
+	for _, a := range missed {
+		if minSeverity != "" && severityRank(a.Severity) < severityRank(minSeverity) {
+			continue
+		}
+		payload, err := json.Marshal(a)
+		if err != nil || !send(a.ID, payload) {
+			return
+		}
+		replayed[a.ID] = true
+	}
+	// An empty comment commits the headers even if there was nothing to replay.
+	if _, err := c.Writer.WriteString(": connected\n\n"); err != nil {
+		return
+	}
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case payload := <-sub:
+			a, err := parseStreamAlert(payload)
+			if err != nil || !a.matches(tenant, minSeverity) || replayed[a.ID] {
+				continue
+			}
+			if !send(a.ID, payload) {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := c.Writer.WriteString(": keep-alive\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// alertsAfter returns up to sseReplayLimit of the tenant's alerts that follow
+// lastID in (created_at, id) order, oldest first. An unknown lastID yields
+// nothing.
+func alertsAfter(c *gin.Context, tenant, lastID string) ([]Alert, error) {
+	rows, err := db.QueryContext(c.Request.Context(), `SELECT `+alertColumns+` FROM alerts
+		WHERE tenant_id = $1 AND (created_at, id) > (SELECT created_at, id FROM alerts WHERE id = $2 AND tenant_id = $1)
+		ORDER BY created_at ASC, id ASC
+		LIMIT $3`, tenant, lastID, sseReplayLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var alerts []Alert
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
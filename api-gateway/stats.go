@@ -0,0 +1,469 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	statsCacheTTL = 30 * time.Second
+
+	defaultStatsDays = 7
+
+	defaultTopThreats = 10
+	maxTopThreats     = 100
+)
+
+// maxStatsDays bounds how far back ?days= and ?since= may reach, so a client
+// can't make the stats queries scan the whole history. Set by STATS_MAX_DAYS.
+var maxStatsDays = 90
+
+// Stats holds the global traffic/threat counters returned by getStats.
+type Stats struct {
+	TotalThreats   int `json:"total_threats"`
+	TotalNormal    int `json:"total_normal"`
+	TotalProcessed int `json:"total_processed"`
+}
+
+// parseSince reads an optional RFC3339 ?since= parameter, which may be at
+// most maxStatsDays days in the past. Without it the window starts at
+// statsWindowStart, so no query scans the whole history. Handlers return the
+// value used as "since" next to the data, so clients can tell which window
+// their totals cover.
+func parseSince(c *gin.Context) (time.Time, error) {
+	v := c.Query("since")
+	if v == "" {
+		return statsWindowStart(), nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid since %q: must be an RFC3339 timestamp", v)
+	}
+	if time.Since(t) > time.Duration(maxStatsDays)*24*time.Hour {
+		return time.Time{}, fmt.Errorf("invalid since %q: must be within the last %d days", v, maxStatsDays)
+	}
+	// Columns are TIMESTAMP without time zone and written in UTC.
+	return t.UTC(), nil
+}
+
+// statsWindowStart is the oldest point a stats query may reach, maxStatsDays
+// days ago in UTC.
+func statsWindowStart() time.Time {
+	return time.Now().UTC().AddDate(0, 0, -maxStatsDays)
+}
+
+// sinceWindow names the ?since= window in cache keys: "max" when the default
+// window was used, which moves with the clock, or else the timestamp.
+func sinceWindow(c *gin.Context, since time.Time) string {
+	if c.Query("since") == "" {
+		return "max"
+	}
+	return since.Format(time.RFC3339)
+}
+
+func getStats(c *gin.Context) {
+	since, err := parseSince(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenant := tenantFromContext(c)
+	cacheKey := statsCacheKey(tenant, sinceWindow(c, since))
+
+	ctx := c.Request.Context()
+	if cached, err := redisClient.Get(ctx, cacheKey).Bytes(); err == nil {
+		var stats Stats
+		if err := json.Unmarshal(cached, &stats); err == nil {
+			respond(c, 200, stats, gin.H{"since": since})
+			return
+		}
+	} else if err != redis.Nil {
+		requestLog(c).Warn("Failed to read stats cache", "error", err)
+	}
+
+	stats, err := queryStats(ctx, tenant, since)
+	if err != nil {
+		requestLog(c).Error("Failed to compute stats", "error", err)
+		internalError(c, "failed to fetch stats")
+		return
+	}
+
+	if payload, err := json.Marshal(stats); err == nil {
+		if err := redisClient.Set(ctx, cacheKey, payload, statsCacheTTL).Err(); err != nil {
+			requestLog(c).Warn("Failed to write stats cache", "error", err)
+		}
+	}
+
+	respond(c, 200, stats, gin.H{"since": since})
+}
+
+// queryStats computes the global counters for a tenant since a point in time.
+// TotalProcessed is extrapolated from rows kept by ingest sampling.
+func queryStats(ctx context.Context, tenant string, since time.Time) (Stats, error) {
+	var stats Stats
+	err := readDB().QueryRowContext(ctx, `SELECT
+			(SELECT COUNT(*) FROM threats WHERE tenant_id = $2 AND label IN ('malicious', 'suspicious') AND created_at >= $1),
+			(SELECT COUNT(*) FROM threats WHERE tenant_id = $2 AND label = 'benign' AND created_at >= $1),
+			(SELECT COALESCE(ROUND(SUM(1 / sample_rate)), 0)::bigint FROM traffic WHERE tenant_id = $2 AND received_at >= $1)`,
+		since, tenant,
+	).Scan(&stats.TotalThreats, &stats.TotalNormal, &stats.TotalProcessed)
+	return stats, err
+}
+
+// DailyStat is one day of the getDailyStats series.
+type DailyStat struct {
+	Date    string `json:"date"`
+	Threats int    `json:"threats"`
+	Normal  int    `json:"normal"`
+}
+
+// parseDays reads ?days= with a default of 7 and an upper bound of
+// maxStatsDays.
+func parseDays(c *gin.Context) (int, error) {
+	v := c.Query("days")
+	if v == "" {
+		return defaultStatsDays, nil
+	}
+	days, err := strconv.Atoi(v)
+	if err != nil || days < 1 || days > maxStatsDays {
+		return 0, fmt.Errorf("invalid days %q: must be between 1 and %d", v, maxStatsDays)
+	}
+	return days, nil
+}
+
+func getDailyStats(c *gin.Context) {
+	days, err := parseDays(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	series, err := queryDailyStats(c.Request.Context(), tenantFromContext(c), days)
+	if err != nil {
+		requestLog(c).Error("Failed to query daily stats", "error", err)
+		internalError(c, "failed to fetch daily stats")
+		return
+	}
+
+	respond(c, 200, series, gin.H{"days": days})
+}
+
+// queryDailyStats returns one entry per day for the last days days, oldest
+// first.
+func queryDailyStats(ctx context.Context, tenant string, days int) ([]DailyStat, error) {
+	// generate_series supplies every day in the window so that days without
+	// any threats still show up with zero counts.
+	rows, err := readDB().QueryContext(ctx, `SELECT d.day,
+			COUNT(t.id) FILTER (WHERE t.label IN ('malicious', 'suspicious')),
+			COUNT(t.id) FILTER (WHERE t.label = 'benign')
+		FROM generate_series(
+			date_trunc('day', LOCALTIMESTAMP) - ($1::int - 1) * INTERVAL '1 day',
+			date_trunc('day', LOCALTIMESTAMP),
+			INTERVAL '1 day'
+		) AS d(day)
+		LEFT JOIN threats t ON date_trunc('day', t.created_at) = d.day AND t.tenant_id = $2
+		GROUP BY d.day
+		ORDER BY d.day ASC`, days, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	series := []DailyStat{}
+	for rows.Next() {
+		var day time.Time
+		var s DailyStat
+		if err := rows.Scan(&day, &s.Threats, &s.Normal); err != nil {
+			return nil, err
+		}
+		s.Date = day.Format("2006-01-02")
+		series = append(series, s)
+	}
+	return series, rows.Err()
+}
+
+// ThreatTypeCount is one entry of the getTopThreats ranking.
+type ThreatTypeCount struct {
+	ThreatType string `json:"threat_type"`
+	Count      int    `json:"count"`
+}
+
+// getTopThreats returns the most common threat types since ?since= (see
+// parseSince). The GROUP BY is shared by every dashboard, so results are cached
+// for statsCacheTTL per limit/window combination.
+func getTopThreats(c *gin.Context) {
+	page, err := parsePage(c, pageSpec{DefaultLimit: defaultTopThreats, MaxLimit: maxTopThreats})
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	limit := page.Limit
+	since, err := parseSince(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenant := tenantFromContext(c)
+	cacheKey := statsCacheKey(tenant, "top-threats", strconv.Itoa(limit), sinceWindow(c, since))
+
+	ctx := c.Request.Context()
+	if cached, err := redisClient.Get(ctx, cacheKey).Bytes(); err == nil {
+		var top []ThreatTypeCount
+		if err := json.Unmarshal(cached, &top); err == nil {
+			respond(c, 200, top, gin.H{"since": since})
+			return
+		}
+	} else if err != redis.Nil {
+		requestLog(c).Warn("Failed to read top threats cache", "error", err)
+	}
+
+	top, err := queryTopThreats(ctx, tenant, since, limit)
+	if err != nil {
+		requestLog(c).Error("Failed to query top threats", "error", err)
+		internalError(c, "failed to fetch top threats")
+		return
+	}
+
+	if payload, err := json.Marshal(top); err == nil {
+		if err := redisClient.Set(ctx, cacheKey, payload, statsCacheTTL).Err(); err != nil {
+			requestLog(c).Warn("Failed to write top threats cache", "error", err)
+		}
+	}
+
+	respond(c, 200, top, gin.H{"since": since})
+}
+
+// queryTopThreats ranks a tenant's malicious and suspicious threat types by
+// count.
+func queryTopThreats(ctx context.Context, tenant string, since time.Time, limit int) ([]ThreatTypeCount, error) {
+	rows, err := readDB().QueryContext(ctx, `SELECT threat_type, COUNT(*)
+		FROM threats
+		WHERE tenant_id = $2 AND label IN ('malicious', 'suspicious') AND threat_type IS NOT NULL
+			AND created_at >= $1
+		GROUP BY threat_type
+		ORDER BY COUNT(*) DESC, threat_type ASC
+		LIMIT $3`, since, tenant, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	top := []ThreatTypeCount{}
+	for rows.Next() {
+		var t ThreatTypeCount
+		if err := rows.Scan(&t.ThreatType, &t.Count); err != nil {
+			return nil, err
+		}
+		top = append(top, t)
+	}
+	return top, rows.Err()
+}
+
+// DailyTypeStat is one day of the getDailyStatsByType series. Counts has an
+// entry for every threat type seen in the window, zero on days it was absent.
+type DailyTypeStat struct {
+	Date   string         `json:"date"`
+	Counts map[string]int `json:"counts"`
+}
+
+func getDailyStatsByType(c *gin.Context) {
+	days, err := parseDays(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Every day is crossed with every type that occurs anywhere in the window,
+	// so the series is dense. The LEFT JOIN on types keeps the days even when
+	// there were no threats at all (threat_type is then NULL).
+	rows, err := readDB().QueryContext(c.Request.Context(), `WITH days AS (
+			SELECT generate_series(
+				date_trunc('day', LOCALTIMESTAMP) - ($1::int - 1) * INTERVAL '1 day',
+				date_trunc('day', LOCALTIMESTAMP),
+				INTERVAL '1 day'
+			) AS day
+		), counts AS (
+			SELECT date_trunc('day', created_at) AS day, threat_type, COUNT(*) AS n
+			FROM threats
+			WHERE tenant_id = $2 AND label IN ('malicious', 'suspicious') AND threat_type IS NOT NULL
+				AND created_at >= (SELECT MIN(day) FROM days)
+			GROUP BY 1, 2
+		), types AS (
+			SELECT DISTINCT threat_type FROM counts
+		)
+		SELECT d.day, t.threat_type, COALESCE(c.n, 0)
+		FROM days d
+		LEFT JOIN types t ON TRUE
+		LEFT JOIN counts c ON c.day = d.day AND c.threat_type = t.threat_type
+		ORDER BY d.day ASC, t.threat_type ASC`, days, tenantFromContext(c))
+	if err != nil {
+		requestLog(c).Error("Failed to query daily stats by type", "error", err)
+		internalError(c, "failed to fetch daily stats")
+		return
+	}
+	defer rows.Close()
+
+	series := []DailyTypeStat{}
+	threatTypes := []string{}
+	for rows.Next() {
+		var day time.Time
+		var threatType *string
+		var n int
+		if err := rows.Scan(&day, &threatType, &n); err != nil {
+			requestLog(c).Error("Failed to scan daily stat", "error", err)
+			internalError(c, "failed to fetch daily stats")
+			return
+		}
+		date := day.Format("2006-01-02")
+		if len(series) == 0 || series[len(series)-1].Date != date {
+			series = append(series, DailyTypeStat{Date: date, Counts: map[string]int{}})
+		}
+		if threatType == nil {
+			continue
+		}
+		series[len(series)-1].Counts[*threatType] = n
+		if len(series) == 1 {
+			threatTypes = append(threatTypes, *threatType)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(c).Error("Failed to iterate daily stats by type", "error", err)
+		internalError(c, "failed to fetch daily stats")
+		return
+	}
+
+	respond(c, 200, series, gin.H{"days": days, "threat_types": threatTypes})
+}
+
+// SourceStats summarizes the threats seen from a single source IP.
+type SourceStats struct {
+	SourceIP      string         `json:"source_ip"`
+	TotalThreats  int            `json:"total_threats"`
+	ByType        map[string]int `json:"by_type"`
+	AvgConfidence *float64       `json:"avg_confidence"`
+	FirstSeen     *time.Time     `json:"first_seen"`
+	LastSeen      *time.Time     `json:"last_seen"`
+}
+
+func getSourceStats(c *gin.Context) {
+	ip := net.ParseIP(c.Param("ip"))
+	if ip == nil {
+		c.JSON(400, gin.H{"error": "invalid ip"})
+		return
+	}
+	since, err := parseSince(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Look the address up in the canonical form ingestion stores.
+	stats := SourceStats{SourceIP: canonicalIP(c.Param("ip")), ByType: map[string]int{}}
+
+	const where = ` WHERE tenant_id = $1 AND source_ip = $2 AND label IN ('malicious', 'suspicious') AND created_at >= $3`
+	args := []interface{}{tenantFromContext(c), stats.SourceIP, since}
+	ctx := c.Request.Context()
+
+	rdb := readDB()
+	err = rdb.QueryRowContext(ctx, "SELECT COUNT(*), AVG(confidence), MIN(created_at), MAX(created_at) FROM threats"+where, args...).
+		Scan(&stats.TotalThreats, &stats.AvgConfidence, &stats.FirstSeen, &stats.LastSeen)
+	if err != nil {
+		requestLog(c).Error("Failed to compute source stats", "source_ip", stats.SourceIP, "error", err)
+		internalError(c, "failed to fetch source stats")
+		return
+	}
+
+	rows, err := rdb.QueryContext(ctx, "SELECT threat_type, COUNT(*) FROM threats"+where+" AND threat_type IS NOT NULL GROUP BY threat_type", args...)
+	if err != nil {
+		requestLog(c).Error("Failed to query source threat types", "source_ip", stats.SourceIP, "error", err)
+		internalError(c, "failed to fetch source stats")
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var threatType string
+		var n int
+		if err := rows.Scan(&threatType, &n); err != nil {
+			requestLog(c).Error("Failed to scan source threat type", "error", err)
+			internalError(c, "failed to fetch source stats")
+			return
+		}
+		stats.ByType[threatType] = n
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(c).Error("Failed to iterate source threat types", "source_ip", stats.SourceIP, "error", err)
+		internalError(c, "failed to fetch source stats")
+		return
+	}
+
+	respond(c, 200, stats, gin.H{"since": since})
+}
+
+const summaryTopThreats = 5
+
+// StatsSummary is the composite payload of getStatsSummary: everything the
+// dashboard needs on first load.
+type StatsSummary struct {
+	Totals     Stats             `json:"totals"`
+	Trend      []DailyStat       `json:"trend"`
+	TopThreats []ThreatTypeCount `json:"top_threats"`
+}
+
+// getStatsSummary combines the counters and top 5 threat types of the last
+// maxStatsDays days with the default 7-day trend. The three queries run
+// concurrently and the result is cached for statsCacheTTL.
+func getStatsSummary(c *gin.Context) {
+	tenant := tenantFromContext(c)
+	cacheKey := statsCacheKey(tenant, "summary")
+	since := statsWindowStart()
+
+	ctx := c.Request.Context()
+	if cached, err := redisClient.Get(ctx, cacheKey).Bytes(); err == nil {
+		var summary StatsSummary
+		if err := json.Unmarshal(cached, &summary); err == nil {
+			respond(c, 200, summary, gin.H{"since": since})
+			return
+		}
+	} else if err != redis.Nil {
+		requestLog(c).Warn("Failed to read stats summary cache", "error", err)
+	}
+
+	var summary StatsSummary
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() (err error) {
+		summary.Totals, err = queryStats(gctx, tenant, since)
+		return err
+	})
+	g.Go(func() (err error) {
+		summary.Trend, err = queryDailyStats(gctx, tenant, defaultStatsDays)
+		return err
+	})
+	g.Go(func() (err error) {
+		summary.TopThreats, err = queryTopThreats(gctx, tenant, since, summaryTopThreats)
+		return err
+	})
+	if err := g.Wait(); err != nil {
+		requestLog(c).Error("Failed to compute stats summary", "error", err)
+		internalError(c, "failed to fetch stats summary")
+		return
+	}
+
+	if payload, err := json.Marshal(summary); err == nil {
+		if err := redisClient.Set(ctx, cacheKey, payload, statsCacheTTL).Err(); err != nil {
+			requestLog(c).Warn("Failed to write stats summary cache", "error", err)
+		}
+	}
+
+	respond(c, 200, summary, gin.H{"since": since})
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/errgroup"
+)
+
+// WindowCounts is the threat and alert activity of one window of
+// getStatsComparison.
+type WindowCounts struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Threats int       `json:"threats"`
+	Alerts  int       `json:"alerts"`
+}
+
+// WindowChange is the change from the previous window to the current one in
+// percent, rounded to one decimal. It is null when the previous count was 0.
+type WindowChange struct {
+	Threats *float64 `json:"threats"`
+	Alerts  *float64 `json:"alerts"`
+}
+
+// StatsComparison is the body of GET /stats/compare.
+type StatsComparison struct {
+	Current  WindowCounts `json:"current"`
+	Previous WindowCounts `json:"previous"`
+	Change   WindowChange `json:"change_percent"`
+}
+
+// getStatsComparison compares the last ?current= (default 7d) with the
+// window of ?previous= (default the same length) right before it. Both
+// windows are counted concurrently and the result is cached for
+// statsCacheTTL.
+func getStatsComparison(c *gin.Context) {
+	current, err := parseCompareWindow(c, "current", defaultStatsDays*24*time.Hour)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	previous, err := parseCompareWindow(c, "previous", current)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if current+previous > time.Duration(maxStatsDays)*24*time.Hour {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("current and previous together must span at most %d days", maxStatsDays)})
+		return
+	}
+
+	tenant := tenantFromContext(c)
+	cacheKey := statsCacheKey(tenant, "compare", current.String(), previous.String())
+
+	ctx := c.Request.Context()
+	if cached, err := redisClient.Get(ctx, cacheKey).Bytes(); err == nil {
+		var comparison StatsComparison
+		if err := json.Unmarshal(cached, &comparison); err == nil {
+			respond(c, 200, comparison, nil)
+			return
+		}
+	} else if err != redis.Nil {
+		requestLog(c).Warn("Failed to read stats comparison cache", "error", err)
+	}
+
+	// Columns are TIMESTAMP without time zone and written in UTC.
+	end := time.Now().UTC()
+	comparison := StatsComparison{
+		Current:  WindowCounts{Start: end.Add(-current), End: end},
+		Previous: WindowCounts{Start: end.Add(-current - previous), End: end.Add(-current)},
+	}
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() error { return queryWindowCounts(gctx, tenant, &comparison.Current) })
+	g.Go(func() error { return queryWindowCounts(gctx, tenant, &comparison.Previous) })
+	if err := g.Wait(); err != nil {
+		requestLog(c).Error("Failed to compare stats windows", "error", err)
+		internalError(c, "failed to fetch stats comparison")
+		return
+	}
+	comparison.Change = WindowChange{
+		Threats: percentChange(comparison.Previous.Threats, comparison.Current.Threats),
+		Alerts:  percentChange(comparison.Previous.Alerts, comparison.Current.Alerts),
+	}
+
+	if payload, err := json.Marshal(comparison); err == nil {
+		if err := redisClient.Set(ctx, cacheKey, payload, statsCacheTTL).Err(); err != nil {
+			requestLog(c).Warn("Failed to write stats comparison cache", "error", err)
+		}
+	}
+
+	respond(c, 200, comparison, nil)
+}
+
+// parseCompareWindow reads a window length such as 7d or 12h.
+func parseCompareWindow(c *gin.Context, name string, fallback time.Duration) (time.Duration, error) {
+	v := c.Query(name)
+	if v == "" {
+		return fallback, nil
+	}
+	d, err := parseRetention(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: use e.g. 7d or 12h", name, v)
+	}
+	return d, nil
+}
+
+// queryWindowCounts fills in the threats (malicious or suspicious, as in
+// Stats) and live alerts created in [w.Start, w.End).
+func queryWindowCounts(ctx context.Context, tenant string, w *WindowCounts) error {
+	return readDB().QueryRowContext(ctx, `SELECT
+			(SELECT COUNT(*) FROM threats WHERE tenant_id = $1 AND label IN ('malicious', 'suspicious') AND created_at >= $2 AND created_at < $3),
+			(SELECT COUNT(*) FROM alerts WHERE tenant_id = $1 AND deleted_at IS NULL AND created_at >= $2 AND created_at < $3)`,
+		tenant, w.Start, w.End,
+	).Scan(&w.Threats, &w.Alerts)
+}
+
+func percentChange(previous, current int) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	change := math.Round(float64(current-previous)/float64(previous)*1000) / 10
+	return &change
+}
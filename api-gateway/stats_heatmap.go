@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	// The runtime image has no zoneinfo, so ?tz= is validated against the
+	// copy embedded in the binary.
+	_ "time/tzdata"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getAlertHeatmap counts the tenant's alerts, leaving out deleted ones, over
+// the last ?days= days by day-of-week and hour-of-day in the ?tz= time zone
+// (an IANA name, UTC by default). data[d][h] is the count for weekday d (0 is
+// Sunday, as in EXTRACT(dow)) and hour h; every cell is present, zero when
+// empty.
+func getAlertHeatmap(c *gin.Context) {
+	days, err := parseDays(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	tz := c.DefaultQuery("tz", "UTC")
+	if _, err := time.LoadLocation(tz); err != nil || tz == "Local" {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("invalid tz %q: must be an IANA time zone name such as Europe/Berlin", tz)})
+		return
+	}
+
+	// created_at is stored as UTC without a time zone, so it is marked as UTC
+	// before being converted to local time.
+	rows, err := readDB().QueryContext(c.Request.Context(), `SELECT
+			EXTRACT(dow FROM local_at)::int, EXTRACT(hour FROM local_at)::int, COUNT(*)
+		FROM (
+			SELECT created_at AT TIME ZONE 'UTC' AT TIME ZONE $3 AS local_at
+			FROM alerts
+			WHERE tenant_id = $1 AND deleted_at IS NULL AND created_at >= LOCALTIMESTAMP - $2::int * INTERVAL '1 day'
+		) a
+		GROUP BY 1, 2`, tenantFromContext(c), days, tz)
+	if err != nil {
+		requestLog(c).Error("Failed to query alert heatmap", "error", err)
+		internalError(c, "failed to fetch alert heatmap")
+		return
+	}
+	defer rows.Close()
+
+	var matrix [7][24]int
+	for rows.Next() {
+		var dow, hour, n int
+		if err := rows.Scan(&dow, &hour, &n); err != nil {
+			requestLog(c).Error("Failed to scan alert heatmap cell", "error", err)
+			internalError(c, "failed to fetch alert heatmap")
+			return
+		}
+		matrix[dow][hour] = n
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(c).Error("Failed to iterate alert heatmap", "error", err)
+		internalError(c, "failed to fetch alert heatmap")
+		return
+	}
+
+	respond(c, 200, matrix, gin.H{"days": days, "tz": tz})
+}
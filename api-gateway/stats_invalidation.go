@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Stats cache invalidation, toggled by STATS_CACHE_INVALIDATION: when traffic
+// is ingested or analyzed, the tenant is published on
+// statsInvalidationChannel and every gateway deletes the tenant's cached
+// stats, so dashboards don't wait out statsCacheTTL. It is off by default
+// because each invalidation sends the next stats requests to the database.
+var (
+	statsInvalidation        = false
+	statsInvalidationChannel = "stats:invalidate"
+	// statsInvalidationInterval is the least time between two messages for
+	// the same tenant from one process; see invalidateStats. Set by
+	// STATS_INVALIDATION_INTERVAL.
+	statsInvalidationInterval = 5 * time.Second
+	statsInvalidations        = &invalidationThrottle{tenants: map[string]*tenantThrottle{}}
+)
+
+// statsCacheKey names a cached stats result of tenant. Every stats key is
+// stats:<tenant>:..., so deleteStatsCache can find them all by prefix.
+func statsCacheKey(tenant string, parts ...string) string {
+	return "stats:" + tenant + ":" + strings.Join(parts, ":")
+}
+
+// invalidateStats publishes tenant on statsInvalidationChannel, at most once
+// per statsInvalidationInterval. A call inside the interval schedules one
+// publish for its end instead, so stats cached meanwhile don't outlive the
+// last write. Failures are only logged; the cached stats still expire on
+// their TTL.
+func invalidateStats(c *gin.Context, tenant string) {
+	if !statsInvalidation {
+		return
+	}
+	delay, ok := statsInvalidations.claim(tenant, time.Now())
+	if !ok {
+		return
+	}
+	if delay > 0 {
+		time.AfterFunc(delay, func() {
+			statsInvalidations.done(tenant)
+			if err := publishStatsInvalidation(context.Background(), tenant); err != nil {
+				slog.Warn("Failed to publish stats invalidation", "tenant_id", tenant, "error", err)
+			}
+		})
+		return
+	}
+	if err := publishStatsInvalidation(c.Request.Context(), tenant); err != nil {
+		requestLog(c).Warn("Failed to publish stats invalidation", "error", err)
+	}
+}
+
+func publishStatsInvalidation(ctx context.Context, tenant string) error {
+	return redisClient.Publish(ctx, statsInvalidationChannel, tenant).Err()
+}
+
+// invalidationThrottle tracks, per tenant, when the last invalidation was or
+// is scheduled to be published.
+type invalidationThrottle struct {
+	mu      sync.Mutex
+	tenants map[string]*tenantThrottle
+}
+
+type tenantThrottle struct {
+	last    time.Time // time of the last publish, or of the scheduled one
+	pending bool      // a publish is scheduled for last
+}
+
+// claim decides how an invalidation of tenant at now is published: right
+// away (0, true), after a delay that ends the current interval (delay, true),
+// or not at all because one is already scheduled (0, false). A scheduled
+// publish must call done when it runs.
+func (t *invalidationThrottle) claim(tenant string, now time.Time) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st, ok := t.tenants[tenant]
+	if !ok {
+		st = &tenantThrottle{}
+		t.tenants[tenant] = st
+	}
+	if st.pending {
+		return 0, false
+	}
+	if now.Sub(st.last) >= statsInvalidationInterval {
+		st.last = now
+		return 0, true
+	}
+	st.last, st.pending = st.last.Add(statsInvalidationInterval), true
+	return st.last.Sub(now), true
+}
+
+// done marks tenant's scheduled publish as sent.
+func (t *invalidationThrottle) done(tenant string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if st, ok := t.tenants[tenant]; ok {
+		st.pending = false
+	}
+}
+
+// runStatsInvalidation deletes the cached stats of each tenant published on
+// statsInvalidationChannel until ctx is canceled.
+func runStatsInvalidation(ctx context.Context) {
+	if !statsInvalidation {
+		return
+	}
+	pubsub := redisClient.Subscribe(ctx, statsInvalidationChannel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			if err := deleteStatsCache(ctx, msg.Payload); err != nil {
+				slog.Warn("Failed to delete cached stats", "tenant_id", msg.Payload, "error", err)
+			}
+		}
+	}
+}
+
+// deleteStatsCache removes every key made by statsCacheKey for tenant.
+func deleteStatsCache(ctx context.Context, tenant string) error {
+	var keys []string
+	iter := redisClient.Scan(ctx, 0, "stats:"+globEscaper.Replace(tenant)+":*", 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return redisClient.Del(ctx, keys...).Err()
+}
+
+// globEscaper quotes the characters Redis MATCH patterns treat specially.
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
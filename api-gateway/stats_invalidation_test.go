@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInvalidationThrottle(t *testing.T) {
+	throttle := &invalidationThrottle{tenants: map[string]*tenantThrottle{}}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+	claim := func(tenant string, now time.Time, wantDelay time.Duration, wantOK bool) {
+		t.Helper()
+		delay, ok := throttle.claim(tenant, now)
+		if delay != wantDelay || ok != wantOK {
+			t.Errorf("claim(%s, +%s) = (%s, %v), want (%s, %v)", tenant, now.Sub(start), delay, ok, wantDelay, wantOK)
+		}
+	}
+
+	interval := statsInvalidationInterval
+	claim("a", at(0), 0, true)                              // first publish goes out at once
+	claim("a", at(time.Second), interval-time.Second, true) // inside the interval: trailing publish at its end
+	claim("a", at(2*time.Second), 0, false)                 // already scheduled
+	claim("b", at(2*time.Second), 0, true)                  // other tenants are independent
+
+	throttle.done("a") // the trailing publish ran at +interval
+	claim("a", at(interval+time.Second), interval-time.Second, true)
+	throttle.done("a")
+	claim("a", at(3*interval), 0, true) // quiet long enough: at once again
+}
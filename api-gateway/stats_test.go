@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseSince(t *testing.T) {
+	saved := maxStatsDays
+	t.Cleanup(func() { maxStatsDays = saved })
+	maxStatsDays = 30
+
+	now := time.Now().UTC()
+	recent := now.Add(-48 * time.Hour).Truncate(time.Second)
+
+	t.Run("default", func(t *testing.T) {
+		got, err := parseSince(pageContext(""))
+		if err != nil {
+			t.Fatalf("parseSince() error = %v", err)
+		}
+		if want := now.AddDate(0, 0, -maxStatsDays); got.Sub(want).Abs() > time.Minute {
+			t.Errorf("parseSince() = %v, want about %v", got, want)
+		}
+	})
+	t.Run("explicit", func(t *testing.T) {
+		in := recent.In(time.FixedZone("UTC+2", 2*60*60)).Format(time.RFC3339)
+		got, err := parseSince(pageContext("since=" + url.QueryEscape(in)))
+		if err != nil {
+			t.Fatalf("parseSince(%q) error = %v", in, err)
+		}
+		if !got.Equal(recent) || got.Location() != time.UTC {
+			t.Errorf("parseSince(%q) = %v, want %v in UTC", in, got, recent)
+		}
+	})
+	for _, v := range []string{"yesterday", "2024-01-01", now.AddDate(0, 0, -31).Format(time.RFC3339)} {
+		t.Run("invalid "+v, func(t *testing.T) {
+			if got, err := parseSince(pageContext("since=" + url.QueryEscape(v))); err == nil {
+				t.Errorf("parseSince(%q) = %v, want an error", v, got)
+			}
+		})
+	}
+}
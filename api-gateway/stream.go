@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// alertsChannel is the Redis pub/sub channel new alerts are published on.
+var alertsChannel = "alerts:new"
+
+// alertHub holds a single Redis subscription to alertsChannel and fans each
+// message out to every connected stream client.
+type alertHub struct {
+	mu             sync.Mutex
+	subscribers    map[chan []byte]struct{}
+	maxSubscribers int
+}
+
+var alertStream = &alertHub{subscribers: map[chan []byte]struct{}{}, maxSubscribers: 100}
+
+// subscribe registers a new client, returning false when the connection cap
+// has been reached.
+func (h *alertHub) subscribe() (chan []byte, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.subscribers) >= h.maxSubscribers {
+		return nil, false
+	}
+	ch := make(chan []byte, 16)
+	h.subscribers[ch] = struct{}{}
+	return ch, true
+}
+
+func (h *alertHub) unsubscribe(ch chan []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers, ch)
+}
+
+// run relays messages from Redis until ctx is canceled. A client whose buffer
+// is full misses the message rather than stalling everyone else.
+func (h *alertHub) run(ctx context.Context) {
+	pubsub := redisClient.Subscribe(ctx, alertsChannel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			payload := []byte(msg.Payload)
+			h.mu.Lock()
+			for ch := range h.subscribers {
+				select {
+				case ch <- payload:
+				default:
+				}
+			}
+			h.mu.Unlock()
+		}
+	}
+}
+
+// streamAlert holds the fields of a published alert that stream filtering
+// needs, without decoding the whole payload.
+type streamAlert struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id"`
+	Severity string `json:"severity"`
+}
+
+// matches reports whether the alert belongs to tenant and has a severity at or
+// above minSeverity. An empty minSeverity matches any level.
+func (a streamAlert) matches(tenant, minSeverity string) bool {
+	if a.TenantID != tenant {
+		return false
+	}
+	return minSeverity == "" || severityRank(a.Severity) >= severityRank(minSeverity)
+}
+
+func parseStreamAlert(payload []byte) (streamAlert, error) {
+	var a streamAlert
+	err := json.Unmarshal(payload, &a)
+	return a, err
+}
+
+const (
+	wsWriteTimeout = 10 * time.Second
+	wsPingInterval = 30 * time.Second
+	wsPongTimeout  = 60 * time.Second
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// Browsers don't apply CORS to WebSockets, so the same origin allowlist
+	// is enforced here. Non-browser clients send no Origin and are allowed.
+	CheckOrigin: func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		return origin == "" || corsOrigins.any || corsOrigins.allows(origin)
+	},
+}
+
+// streamAlerts upgrades to a WebSocket and pushes each of the tenant's new
+// alerts as a JSON text message. ?severity= limits the stream to alerts at or
+// above a level.
+func streamAlerts(c *gin.Context) {
+	tenant := tenantFromContext(c)
+	minSeverity := c.Query("severity")
+	if minSeverity != "" && !contains(validAlertSeverities, minSeverity) {
+		c.JSON(400, gin.H{"error": "invalid severity: must be one of low, medium, high, critical"})
+		return
+	}
+
+	sub, ok := alertStream.subscribe()
+	if !ok {
+		c.JSON(503, gin.H{"error": "too many concurrent alert streams"})
+		return
+	}
+	defer alertStream.unsubscribe(sub)
+
+	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade has already written an error response.
+		return
+	}
+	defer conn.Close()
+
+	// Clients don't send us anything meaningful, but reading is how close
+	// frames and dropped connections are noticed.
+	closed := make(chan struct{})
+	conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case payload := <-sub:
+			if a, err := parseStreamAlert(payload); err != nil || !a.matches(tenant, minSeverity) {
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+				requestLog(c).Warn("Alert stream write failed, closing", "error", err)
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
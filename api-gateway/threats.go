@@ -0,0 +1,229 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Threat mirrors a row of the threats table.
+type Threat struct {
+	ID         string    `json:"id"`
+	TenantID   string    `json:"tenant_id"`
+	TrafficID  *string   `json:"traffic_id"`
+	SourceIP   string    `json:"source_ip"`
+	ThreatType *string   `json:"threat_type"`
+	Label      string    `json:"label"`
+	Confidence float64   `json:"confidence"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+const threatColumns = `id, tenant_id, traffic_id, source_ip, threat_type, label, confidence, created_at, updated_at`
+
+func scanThreat(s rowScanner) (Threat, error) {
+	var t Threat
+	err := s.Scan(&t.ID, &t.TenantID, &t.TrafficID, &t.SourceIP, &t.ThreatType, &t.Label, &t.Confidence, &t.CreatedAt, &t.UpdatedAt)
+	return t, err
+}
+
+// threatSortOrders maps the ?sort= values of getThreats to ORDER BY clauses.
+var threatSortOrders = map[string]string{
+	"confidence": "confidence DESC, created_at DESC",
+	"recent":     "created_at DESC",
+}
+
+var threatPageSpec = pageSpec{DefaultLimit: defaultPageLimit, MaxLimit: maxPageLimit, Sorts: []string{"confidence", "recent"}}
+
+func getThreats(c *gin.Context) {
+	page, err := parsePage(c, threatPageSpec)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	orderBy := threatSortOrders[page.Sort]
+
+	args := []interface{}{tenantFromContext(c)}
+	conditions := []string{"tenant_id = $1"}
+
+	if threatType := c.Query("type"); threatType != "" {
+		args = append(args, threatType)
+		conditions = append(conditions, fmt.Sprintf("threat_type = $%d", len(args)))
+	}
+	if v := c.Query("min_confidence"); v != "" {
+		minConfidence, err := strconv.ParseFloat(v, 64)
+		if err != nil || minConfidence < 0 || minConfidence > 1 {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("invalid min_confidence %q: must be between 0 and 1", v)})
+			return
+		}
+		args = append(args, minConfidence)
+		conditions = append(conditions, fmt.Sprintf("confidence >= $%d", len(args)))
+	}
+	if sourceIP := c.Query("source_ip"); sourceIP != "" {
+		args = append(args, canonicalIP(sourceIP))
+		conditions = append(conditions, fmt.Sprintf("source_ip = $%d", len(args)))
+	}
+	// ?country= matches the GeoIP country of the threat's source traffic.
+	if country := c.Query("country"); country != "" {
+		if len(country) != 2 {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("invalid country %q: must be an ISO 3166-1 alpha-2 code", country)})
+			return
+		}
+		args = append(args, strings.ToUpper(country))
+		conditions = append(conditions, fmt.Sprintf("traffic_id IN (SELECT id FROM traffic WHERE tenant_id = $1 AND country = $%d)", len(args)))
+	}
+
+	where := " WHERE " + strings.Join(conditions, " AND ")
+
+	var total int
+	rdb := readDB()
+	if err := rdb.QueryRowContext(c.Request.Context(), "SELECT COUNT(*) FROM threats"+where, args...).Scan(&total); err != nil {
+		requestLog(c).Error("Failed to count threats", "error", err)
+		internalError(c, "failed to fetch threats")
+		return
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM threats%s ORDER BY %s, id DESC LIMIT $%d OFFSET $%d",
+		threatColumns, where, orderBy, len(args)+1, len(args)+2)
+	rows, err := rdb.QueryContext(c.Request.Context(), query, append(args, page.Limit, page.Offset())...)
+	if err != nil {
+		requestLog(c).Error("Failed to query threats", "error", err)
+		internalError(c, "failed to fetch threats")
+		return
+	}
+	defer rows.Close()
+
+	threats := []Threat{}
+	for rows.Next() {
+		t, err := scanThreat(rows)
+		if err != nil {
+			requestLog(c).Error("Failed to scan threat", "error", err)
+			internalError(c, "failed to fetch threats")
+			return
+		}
+		threats = append(threats, t)
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(c).Error("Failed to iterate threats", "error", err)
+		internalError(c, "failed to fetch threats")
+		return
+	}
+
+	setPageLinks(c, total, page)
+	respond(c, 200, threats, gin.H{"pagination": newPagination(total, page)})
+}
+
+func getThreat(c *gin.Context) {
+	id := c.Param("id")
+	if !isValidUUID(id) {
+		c.JSON(400, gin.H{"error": "invalid threat id"})
+		return
+	}
+
+	threat, err := scanThreat(db.QueryRowContext(c.Request.Context(), "SELECT "+threatColumns+" FROM threats WHERE id = $1 AND tenant_id = $2", id, tenantFromContext(c)))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"error": "threat not found"})
+		return
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to fetch threat", "threat_id", id, "error", err)
+		internalError(c, "failed to fetch threat")
+		return
+	}
+
+	rows, err := db.QueryContext(c.Request.Context(), "SELECT "+alertColumns+" FROM alerts WHERE threat_id = $1 AND tenant_id = $2 ORDER BY created_at DESC", id, tenantFromContext(c))
+	if err != nil {
+		requestLog(c).Error("Failed to query alerts for threat", "threat_id", id, "error", err)
+		internalError(c, "failed to fetch threat")
+		return
+	}
+	defer rows.Close()
+
+	alerts := []Alert{}
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			requestLog(c).Error("Failed to scan alert", "error", err)
+			internalError(c, "failed to fetch threat")
+			return
+		}
+		alerts = append(alerts, a)
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(c).Error("Failed to iterate alerts for threat", "threat_id", id, "error", err)
+		internalError(c, "failed to fetch threat")
+		return
+	}
+
+	respondWithETag(c, threat, gin.H{"alerts": alerts})
+}
+
+// SourceSummary aggregates the threats seen from one source IP.
+type SourceSummary struct {
+	SourceIP      string    `json:"source_ip"`
+	ThreatCount   int       `json:"threat_count"`
+	AvgConfidence float64   `json:"avg_confidence"`
+	LastSeen      time.Time `json:"last_seen"`
+}
+
+// getThreatsBySource ranks source IPs by how many malicious or suspicious
+// threats they produced since ?since= (see parseSince).
+func getThreatsBySource(c *gin.Context) {
+	page, err := parsePage(c, defaultPageSpec)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	since, err := parseSince(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	const where = ` WHERE tenant_id = $2 AND label IN ('malicious', 'suspicious') AND created_at >= $1`
+	tenant := tenantFromContext(c)
+
+	var total int
+	rdb := readDB()
+	if err := rdb.QueryRowContext(c.Request.Context(), "SELECT COUNT(DISTINCT source_ip) FROM threats"+where, since, tenant).Scan(&total); err != nil {
+		requestLog(c).Error("Failed to count threat sources", "error", err)
+		internalError(c, "failed to fetch threat sources")
+		return
+	}
+
+	rows, err := rdb.QueryContext(c.Request.Context(), `SELECT source_ip, COUNT(*), AVG(confidence), MAX(created_at)
+		FROM threats`+where+`
+		GROUP BY source_ip
+		ORDER BY COUNT(*) DESC, MAX(created_at) DESC
+		LIMIT $3 OFFSET $4`, since, tenant, page.Limit, page.Offset())
+	if err != nil {
+		requestLog(c).Error("Failed to query threat sources", "error", err)
+		internalError(c, "failed to fetch threat sources")
+		return
+	}
+	defer rows.Close()
+
+	sources := []SourceSummary{}
+	for rows.Next() {
+		var s SourceSummary
+		if err := rows.Scan(&s.SourceIP, &s.ThreatCount, &s.AvgConfidence, &s.LastSeen); err != nil {
+			requestLog(c).Error("Failed to scan threat source", "error", err)
+			internalError(c, "failed to fetch threat sources")
+			return
+		}
+		sources = append(sources, s)
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(c).Error("Failed to iterate threat sources", "error", err)
+		internalError(c, "failed to fetch threat sources")
+		return
+	}
+
+	setPageLinks(c, total, page)
+	respond(c, 200, sources, gin.H{"pagination": newPagination(total, page), "since": since})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TimelineEvent is one entry of a threat's timeline. Type is threat_created,
+// threat_reanalysis or threat_replay (a verdict change from threat_audit),
+// alert_created, or alert_<action> for an alert_audit record such as
+// alert_status_change or alert_escalation. AlertID is set on alert events and
+// Actor on changes someone made; Details carries the event's fields.
+type TimelineEvent struct {
+	Type    string          `json:"type"`
+	At      time.Time       `json:"at"`
+	AlertID *string         `json:"alert_id"`
+	Actor   *string         `json:"actor"`
+	Details json.RawMessage `json:"details"`
+}
+
+// getThreatTimeline returns the history of a threat, oldest first: its
+// creation (with the verdict it was created with), each change of verdict,
+// and the creation and every audited change of the alerts raised for it,
+// soft-deleted ones included.
+func getThreatTimeline(c *gin.Context) {
+	id := c.Param("id")
+	if !isValidUUID(id) {
+		c.JSON(400, gin.H{"error": "invalid threat id"})
+		return
+	}
+
+	// The threat's original verdict is the old side of its first audit
+	// record, if the verdict ever changed.
+	rows, err := readDB().QueryContext(c.Request.Context(), `SELECT type, at, alert_id, actor, details FROM (
+			SELECT 'threat_created' AS type, th.created_at AS at, NULL::text AS alert_id, NULL::text AS actor,
+				CASE WHEN first.threat_id IS NULL
+					THEN jsonb_build_object('source_ip', th.source_ip, 'label', th.label, 'threat_type', th.threat_type, 'confidence', th.confidence)
+					ELSE jsonb_build_object('source_ip', th.source_ip, 'label', first.old_label, 'threat_type', first.old_threat_type, 'confidence', first.old_confidence)
+				END AS details, 0 AS seq
+			FROM threats th
+			LEFT JOIN LATERAL (
+				SELECT threat_id, old_label, old_threat_type, old_confidence FROM threat_audit
+				WHERE threat_id = th.id ORDER BY changed_at ASC, id ASC LIMIT 1
+			) first ON true
+			WHERE th.id = $1 AND th.tenant_id = $2
+			UNION ALL
+			SELECT 'threat_' || ta.action, ta.changed_at, NULL, ta.changed_by,
+				jsonb_build_object('old_label', ta.old_label, 'new_label', ta.new_label,
+					'old_threat_type', ta.old_threat_type, 'new_threat_type', ta.new_threat_type,
+					'old_confidence', ta.old_confidence, 'new_confidence', ta.new_confidence), 1
+			FROM threat_audit ta
+			JOIN threats th ON th.id = ta.threat_id
+			WHERE ta.threat_id = $1 AND th.tenant_id = $2
+			UNION ALL
+			SELECT 'alert_created', a.created_at, a.id::text, NULL,
+				jsonb_build_object('severity', a.severity, 'description', a.description), 2
+			FROM alerts a
+			WHERE a.threat_id = $1 AND a.tenant_id = $2
+			UNION ALL
+			SELECT 'alert_' || aa.action, aa.changed_at, aa.alert_id::text, aa.changed_by,
+				jsonb_strip_nulls(jsonb_build_object(
+					'old_status', aa.old_status, 'new_status', aa.new_status,
+					'old_severity', aa.old_severity, 'new_severity', aa.new_severity,
+					'old_assignee', aa.old_assignee, 'new_assignee', aa.new_assignee)), 3
+			FROM alert_audit aa
+			JOIN alerts a ON a.id = aa.alert_id
+			WHERE a.threat_id = $1 AND a.tenant_id = $2
+		) timeline
+		ORDER BY at ASC, seq ASC`, id, tenantFromContext(c))
+	if err != nil {
+		requestLog(c).Error("Failed to query threat timeline", "threat_id", id, "error", err)
+		internalError(c, "failed to fetch threat timeline")
+		return
+	}
+	defer rows.Close()
+
+	events := []TimelineEvent{}
+	for rows.Next() {
+		var e TimelineEvent
+		var details []byte
+		if err := rows.Scan(&e.Type, &e.At, &e.AlertID, &e.Actor, &details); err != nil {
+			requestLog(c).Error("Failed to scan threat timeline", "threat_id", id, "error", err)
+			internalError(c, "failed to fetch threat timeline")
+			return
+		}
+		e.Details = details
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(c).Error("Failed to iterate threat timeline", "threat_id", id, "error", err)
+		internalError(c, "failed to fetch threat timeline")
+		return
+	}
+	// Every existing threat has at least its threat_created event.
+	if len(events) == 0 {
+		c.JSON(404, gin.H{"error": "threat not found"})
+		return
+	}
+
+	respond(c, 200, events, nil)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultTimeseriesBuckets = 30
+	maxTimeseriesBuckets     = 500
+)
+
+// timeseriesGranularities maps each ?granularity=, which doubles as the
+// date_trunc field, to its generate_series interval and that interval's length.
+var timeseriesGranularities = map[string]struct {
+	interval string
+	step     time.Duration
+}{
+	"hour": {"1 hour", time.Hour},
+	"day":  {"1 day", 24 * time.Hour},
+	"week": {"1 week", 7 * 24 * time.Hour},
+}
+
+// ThreatBucket is one step of the getThreatTimeseries series.
+type ThreatBucket struct {
+	Bucket time.Time `json:"bucket"`
+	Count  int       `json:"count"`
+}
+
+// getThreatTimeseries counts the tenant's malicious and suspicious threats per
+// hour, day or week (?granularity=, default day) from ?since= until now,
+// oldest first. Every bucket in the range is present, zero when empty, so the
+// series is evenly spaced. Buckets start at date_trunc boundaries (weeks on
+// Monday), so the first may begin before since. Without since the series
+// covers the last defaultTimeseriesBuckets buckets.
+func getThreatTimeseries(c *gin.Context) {
+	granularity := c.DefaultQuery("granularity", "day")
+	g, ok := timeseriesGranularities[granularity]
+	if !ok {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("invalid granularity %q: must be hour, day or week", granularity)})
+		return
+	}
+	since, err := parseSince(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if c.Query("since") == "" {
+		// Columns are TIMESTAMP without time zone and written in UTC.
+		since = time.Now().UTC().Add(-(defaultTimeseriesBuckets - 1) * g.step)
+	}
+	if n := int(time.Since(since)/g.step) + 1; n > maxTimeseriesBuckets {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("range covers %d %s buckets, more than the maximum of %d: use a later since or a coarser granularity",
+			n, granularity, maxTimeseriesBuckets)})
+		return
+	}
+
+	rows, err := readDB().QueryContext(c.Request.Context(), `SELECT b.bucket, COUNT(t.id)
+		FROM generate_series(
+			date_trunc($1, $2::timestamp),
+			date_trunc($1, LOCALTIMESTAMP),
+			$3::interval
+		) AS b(bucket)
+		LEFT JOIN threats t ON t.tenant_id = $4 AND t.label IN ('malicious', 'suspicious')
+			AND t.created_at >= b.bucket AND t.created_at < b.bucket + $3::interval
+		GROUP BY b.bucket
+		ORDER BY b.bucket ASC`, granularity, since, g.interval, tenantFromContext(c))
+	if err != nil {
+		requestLog(c).Error("Failed to query threat timeseries", "error", err)
+		internalError(c, "failed to fetch threat timeseries")
+		return
+	}
+	defer rows.Close()
+
+	series := []ThreatBucket{}
+	for rows.Next() {
+		var b ThreatBucket
+		if err := rows.Scan(&b.Bucket, &b.Count); err != nil {
+			requestLog(c).Error("Failed to scan threat timeseries bucket", "error", err)
+			internalError(c, "failed to fetch threat timeseries")
+			return
+		}
+		series = append(series, b)
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(c).Error("Failed to iterate threat timeseries", "error", err)
+		internalError(c, "failed to fetch threat timeseries")
+		return
+	}
+
+	respond(c, 200, series, gin.H{"granularity": granularity, "since": since})
+}
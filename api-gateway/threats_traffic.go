@@ -0,0 +1,82 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RawTraffic is a traffic row exactly as stored, including the syslog message
+// and enrichment that the threat endpoints leave out.
+type RawTraffic struct {
+	ID             string    `json:"id"`
+	SourceIP       string    `json:"source_ip"`
+	DestIP         *string   `json:"dest_ip"`
+	SourcePort     *int      `json:"source_port"`
+	DestPort       *int      `json:"dest_port"`
+	Protocol       string    `json:"protocol"`
+	Bytes          int64     `json:"bytes"`
+	PacketCount    int64     `json:"packet_count"`
+	Duration       float64   `json:"duration"`
+	Label          *string   `json:"label"`
+	SchemaVersion  int       `json:"schema_version"`
+	Country        *string   `json:"country"`
+	City           *string   `json:"city"`
+	ASN            *int64    `json:"asn"`
+	ASOrg          *string   `json:"as_org"`
+	SampleRate     float64   `json:"sample_rate"`
+	SyslogSeverity *int      `json:"syslog_severity"`
+	Message        *string   `json:"message"`
+	ReceivedAt     time.Time `json:"received_at"`
+}
+
+// getThreatTraffic returns the traffic record a threat was scored from, for
+// forensics. Raw records can carry payload data such as syslog messages, so
+// the route needs the forensics scope and each access is logged. A threat
+// whose traffic was never linked or has since been purged gives a 404.
+func getThreatTraffic(c *gin.Context) {
+	id := c.Param("id")
+	if !isValidUUID(id) {
+		c.JSON(400, gin.H{"error": "invalid threat id"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	var trafficID *string
+	err := readDB().QueryRowContext(ctx, "SELECT traffic_id FROM threats WHERE id = $1 AND tenant_id = $2",
+		id, tenantFromContext(c)).Scan(&trafficID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"error": "threat not found"})
+		return
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to fetch threat", "threat_id", id, "error", err)
+		internalError(c, "failed to fetch threat traffic")
+		return
+	}
+	if trafficID == nil {
+		c.JSON(404, gin.H{"error": "source traffic for threat not found"})
+		return
+	}
+
+	var t RawTraffic
+	err = readDB().QueryRowContext(ctx, `SELECT id, source_ip, dest_ip, source_port, dest_port, protocol, bytes, packet_count, duration,
+			label, schema_version, country, city, asn, as_org, sample_rate, syslog_severity, message, received_at
+		FROM traffic WHERE id = $1 AND tenant_id = $2`, *trafficID, tenantFromContext(c)).Scan(
+		&t.ID, &t.SourceIP, &t.DestIP, &t.SourcePort, &t.DestPort, &t.Protocol, &t.Bytes, &t.PacketCount, &t.Duration,
+		&t.Label, &t.SchemaVersion, &t.Country, &t.City, &t.ASN, &t.ASOrg, &t.SampleRate, &t.SyslogSeverity, &t.Message, &t.ReceivedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"error": "source traffic for threat not found"})
+		return
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to fetch traffic for threat", "threat_id", id, "error", err)
+		internalError(c, "failed to fetch threat traffic")
+		return
+	}
+
+	requestLog(c).Info("Served raw traffic for threat", "threat_id", id, "traffic_id", t.ID, "actor", actorFromContext(c))
+	respond(c, 200, []RawTraffic{t}, nil)
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// webhookQueueKey is the Redis list new alerts are queued on for the
+	// delivery worker; webhookRetryKey is a sorted set of failed deliveries
+	// scored by when they are due again.
+	webhookQueueKey = "webhooks:queue"
+	webhookRetryKey = "webhooks:retry"
+
+	webhookMaxAttempts = 5
+	webhookBaseBackoff = 5 * time.Second
+)
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// Webhook mirrors a row of the webhooks table. The secret is write-only.
+type Webhook struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	Secret      *string   `json:"-"`
+	HasSecret   bool      `json:"has_secret"`
+	MinSeverity string    `json:"min_severity"`
+	IsActive    bool      `json:"is_active"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+const webhookColumns = `id, url, secret, min_severity, is_active, created_by, created_at`
+
+func scanWebhook(s rowScanner) (Webhook, error) {
+	var w Webhook
+	err := s.Scan(&w.ID, &w.URL, &w.Secret, &w.MinSeverity, &w.IsActive, &w.CreatedBy, &w.CreatedAt)
+	w.HasSecret = w.Secret != nil && *w.Secret != ""
+	return w, err
+}
+
+func listWebhooks(c *gin.Context) {
+	page, err := parsePage(c, defaultPageSpec)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	tenant := tenantFromContext(c)
+
+	var total int
+	rdb := readDB()
+	if err := rdb.QueryRowContext(c.Request.Context(), "SELECT COUNT(*) FROM webhooks WHERE tenant_id = $1", tenant).Scan(&total); err != nil {
+		requestLog(c).Error("Failed to count webhooks", "error", err)
+		internalError(c, "failed to fetch webhooks")
+		return
+	}
+
+	rows, err := rdb.QueryContext(c.Request.Context(),
+		"SELECT "+webhookColumns+" FROM webhooks WHERE tenant_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2 OFFSET $3",
+		tenant, page.Limit, page.Offset())
+	if err != nil {
+		requestLog(c).Error("Failed to query webhooks", "error", err)
+		internalError(c, "failed to fetch webhooks")
+		return
+	}
+	defer rows.Close()
+
+	hooks := []Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			requestLog(c).Error("Failed to scan webhook", "error", err)
+			internalError(c, "failed to fetch webhooks")
+			return
+		}
+		hooks = append(hooks, w)
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(c).Error("Failed to iterate webhooks", "error", err)
+		internalError(c, "failed to fetch webhooks")
+		return
+	}
+
+	setPageLinks(c, total, page)
+	respond(c, 200, hooks, gin.H{"pagination": newPagination(total, page)})
+}
+
+// CreateWebhookRequest is the body of POST /webhooks. MinSeverity defaults to
+// high.
+type CreateWebhookRequest struct {
+	URL         string  `json:"url" binding:"required"`
+	Secret      *string `json:"secret"`
+	MinSeverity string  `json:"min_severity"`
+}
+
+func createWebhook(c *gin.Context) {
+	var req CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+		return
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		c.JSON(400, gin.H{"error": "invalid url: must be an absolute http or https URL"})
+		return
+	}
+	if req.MinSeverity == "" {
+		req.MinSeverity = "high"
+	}
+	if !contains(validAlertSeverities, req.MinSeverity) {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("invalid min_severity %q: must be one of %s", req.MinSeverity, strings.Join(validAlertSeverities, ", "))})
+		return
+	}
+
+	hook, err := scanWebhook(db.QueryRowContext(c.Request.Context(),
+		`INSERT INTO webhooks (tenant_id, url, secret, min_severity, created_by)
+		VALUES ($1, $2, $3, $4, $5) RETURNING `+webhookColumns,
+		tenantFromContext(c), u.String(), req.Secret, req.MinSeverity, actorFromContext(c),
+	))
+	if err != nil {
+		requestLog(c).Error("Failed to insert webhook", "error", err)
+		internalError(c, "failed to create webhook")
+		return
+	}
+
+	respond(c, 201, hook, nil)
+}
+
+func deleteWebhook(c *gin.Context) {
+	id := c.Param("id")
+	if !isValidUUID(id) {
+		c.JSON(400, gin.H{"error": "invalid webhook id"})
+		return
+	}
+
+	result, err := db.ExecContext(c.Request.Context(), "DELETE FROM webhooks WHERE id = $1 AND tenant_id = $2", id, tenantFromContext(c))
+	if err != nil {
+		requestLog(c).Error("Failed to delete webhook", "webhook_id", id, "error", err)
+		internalError(c, "failed to delete webhook")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(404, gin.H{"error": "webhook not found"})
+		return
+	}
+
+	c.Status(204)
+}
+
+// webhookJob is an entry of the delivery queue. A job without a WebhookID is a
+// freshly raised alert that still has to be fanned out to the tenant's
+// webhooks; the worker turns it into one job per matching webhook.
+type webhookJob struct {
+	TenantID  string          `json:"tenant_id"`
+	Severity  string          `json:"severity"`
+	Alert     json.RawMessage `json:"alert"`
+	WebhookID string          `json:"webhook_id,omitempty"`
+	Attempt   int             `json:"attempt,omitempty"`
+}
+
+// enqueueAlertWebhooks queues a new alert for webhook delivery. It only costs
+// one Redis push, so it is safe to call on the request path.
+func enqueueAlertWebhooks(ctx context.Context, alert Alert) error {
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	job, err := json.Marshal(webhookJob{TenantID: alert.TenantID, Severity: alert.Severity, Alert: payload})
+	if err != nil {
+		return err
+	}
+	return redisClient.LPush(ctx, webhookQueueKey, job).Err()
+}
+
+// runWebhookWorker delivers queued webhook jobs until ctx is canceled. Failed
+// deliveries are parked in webhookRetryKey and moved back onto the queue once
+// their backoff has elapsed.
+func runWebhookWorker(ctx context.Context) {
+	go promoteWebhookRetries(ctx)
+
+	for ctx.Err() == nil {
+		res, err := redisClient.BRPop(ctx, 5*time.Second, webhookQueueKey).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Warn("Failed to read webhook queue", "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		var job webhookJob
+		if err := json.Unmarshal([]byte(res[1]), &job); err != nil {
+			slog.Warn("Dropping malformed webhook job", "error", err)
+			continue
+		}
+		if job.WebhookID == "" {
+			fanOutWebhookJob(ctx, job)
+			continue
+		}
+		hook, err := scanWebhook(db.QueryRowContext(ctx,
+			"SELECT "+webhookColumns+" FROM webhooks WHERE id = $1 AND tenant_id = $2 AND is_active", job.WebhookID, job.TenantID))
+		if errors.Is(err, sql.ErrNoRows) {
+			// Deleted or disabled since the first attempt.
+			continue
+		}
+		if err != nil {
+			slog.Warn("Failed to load webhook", "webhook_id", job.WebhookID, "error", err)
+			scheduleWebhookRetry(ctx, job)
+			continue
+		}
+		deliverWebhook(ctx, hook, job)
+	}
+}
+
+// fanOutWebhookJob delivers an alert to every active webhook of its tenant
+// whose min_severity it reaches.
+func fanOutWebhookJob(ctx context.Context, job webhookJob) {
+	rows, err := db.QueryContext(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE tenant_id = $1 AND is_active", job.TenantID)
+	if err != nil {
+		slog.Warn("Failed to query webhooks for alert", "error", err)
+		return
+	}
+	var hooks []Webhook
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			slog.Warn("Failed to scan webhook", "error", err)
+			continue
+		}
+		if severityRank(job.Severity) >= severityRank(w.MinSeverity) {
+			hooks = append(hooks, w)
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		slog.Warn("Failed to iterate webhooks for alert", "error", err)
+		return
+	}
+
+	for _, hook := range hooks {
+		j := job
+		j.WebhookID = hook.ID
+		deliverWebhook(ctx, hook, j)
+	}
+}
+
+// webhookPermanentError marks a response that retrying won't fix.
+type webhookPermanentError struct{ status int }
+
+func (e webhookPermanentError) Error() string {
+	return fmt.Sprintf("webhook responded %d", e.status)
+}
+
+// deliverWebhook makes one delivery attempt, scheduling a retry with
+// exponential backoff if it fails with a network error, a 5xx or a 429.
+func deliverWebhook(ctx context.Context, hook Webhook, job webhookJob) {
+	job.Attempt++
+	err := postWebhook(ctx, hook, job.Alert)
+	if err == nil {
+		webhookDeliveriesTotal.WithLabelValues("delivered").Inc()
+		return
+	}
+
+	var permanent webhookPermanentError
+	if errors.As(err, &permanent) || job.Attempt >= webhookMaxAttempts {
+		webhookDeliveriesTotal.WithLabelValues("failed").Inc()
+		slog.Warn("Giving up on webhook delivery", "webhook_id", hook.ID, "attempt", job.Attempt, "error", err)
+		return
+	}
+	webhookDeliveriesTotal.WithLabelValues("retried").Inc()
+	slog.Warn("Webhook delivery failed, will retry", "webhook_id", hook.ID, "attempt", job.Attempt, "error", err)
+	scheduleWebhookRetry(ctx, job)
+}
+
+func scheduleWebhookRetry(ctx context.Context, job webhookJob) {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return
+	}
+	due := time.Now().Add(webhookBaseBackoff << max(job.Attempt-1, 0))
+	if err := redisClient.ZAdd(ctx, webhookRetryKey, redis.Z{Score: float64(due.Unix()), Member: payload}).Err(); err != nil {
+		slog.Warn("Failed to schedule webhook retry", "webhook_id", job.WebhookID, "error", err)
+	}
+}
+
+// postWebhook sends the alert to hook.URL. When the webhook has a secret the
+// request carries X-Webhook-Signature: sha256=<hex HMAC of "timestamp.body">,
+// with the timestamp in X-Webhook-Timestamp so receivers can reject replays.
+func postWebhook(ctx context.Context, hook Webhook, alert json.RawMessage) error {
+	body, err := json.Marshal(gin.H{"event": "alert.created", "alert": alert})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return webhookPermanentError{}
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "threat-detector-webhooks")
+	req.Header.Set("X-Webhook-Event", "alert.created")
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	if hook.HasSecret {
+		mac := hmac.New(sha256.New, []byte(*hook.Secret))
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(body)
+		req.Header.Set("X-Webhook-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == 429 || resp.StatusCode >= 500:
+		return fmt.Errorf("webhook responded %d", resp.StatusCode)
+	default:
+		return webhookPermanentError{status: resp.StatusCode}
+	}
+}
+
+// promoteWebhookRetries moves due retries back onto the queue once a second.
+// ZREM decides which gateway replica gets to requeue a job, so each retry runs
+// once.
+func promoteWebhookRetries(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		due, err := redisClient.ZRangeByScore(ctx, webhookRetryKey, &redis.ZRangeBy{
+			Min: "-inf", Max: strconv.FormatInt(time.Now().Unix(), 10), Count: 100,
+		}).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Warn("Failed to read webhook retries", "error", err)
+			}
+			continue
+		}
+		for _, job := range due {
+			removed, err := redisClient.ZRem(ctx, webhookRetryKey, job).Result()
+			if err != nil || removed == 0 {
+				continue
+			}
+			if err := redisClient.LPush(ctx, webhookQueueKey, job).Err(); err != nil {
+				slog.Warn("Failed to requeue webhook retry", "error", err)
+			}
+		}
+	}
+}
@@ -32,7 +32,7 @@ function App() {
       
       if (statsResponse.ok) {
         const statsData = await statsResponse.json();
-        setStats(statsData.stats || stats);
+        setStats(statsData.data || stats);
       }
 
       // Fetch alerts
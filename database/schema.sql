@@ -65,10 +65,63 @@ CREATE TABLE IF NOT EXISTS threat_predictions (
     CONSTRAINT check_confidence CHECK (confidence >= 0 AND confidence <= 1)
 );
 
+-- Traffic Table (flow records submitted by agents or via /analyze)
+CREATE TABLE IF NOT EXISTS traffic (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+    source_ip VARCHAR(45) NOT NULL,
+    dest_ip VARCHAR(45),
+    source_port INTEGER,
+    dest_port INTEGER,
+    protocol VARCHAR(10) NOT NULL,
+    bytes BIGINT NOT NULL DEFAULT 0,
+    packet_count BIGINT NOT NULL DEFAULT 0,
+    duration FLOAT NOT NULL DEFAULT 0,
+    label VARCHAR(20), -- preset verdict, e.g. 'benign' for allowlisted sources
+    schema_version SMALLINT NOT NULL DEFAULT 1, -- ingest payload format the row was decoded from
+    country VARCHAR(2), -- GeoIP enrichment of source_ip; NULL when unknown
+    city VARCHAR(100),
+    asn BIGINT,
+    as_org VARCHAR(255),
+    sample_rate REAL NOT NULL DEFAULT 1, -- probability the row was kept with when ingest sampling is on; each row stands for 1 / sample_rate records
+    syslog_severity SMALLINT, -- 0 (emergency) to 7 (debug); NULL for records not received as syslog
+    message TEXT, -- syslog message text, truncated
+    received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Threats Table (scored verdicts for traffic records)
+CREATE TABLE IF NOT EXISTS threats (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+    traffic_id UUID REFERENCES traffic(id) ON DELETE SET NULL,
+    source_ip VARCHAR(45) NOT NULL,
+    threat_type VARCHAR(50), -- 'DoS', 'Probe', 'R2L', 'U2R', NULL for benign
+    label VARCHAR(20) NOT NULL, -- 'malicious', 'suspicious', 'benign', 'unknown' (no rule matched)
+    confidence FLOAT NOT NULL, -- threat score (0-1) from the scoring rules
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT check_threat_label CHECK (label IN ('malicious', 'suspicious', 'benign', 'unknown')),
+    CONSTRAINT check_threat_confidence CHECK (confidence >= 0 AND confidence <= 1)
+);
+
+-- Incidents Table (related alerts grouped for triage; severity is derived
+-- from the member alerts)
+CREATE TABLE IF NOT EXISTS incidents (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+    title TEXT NOT NULL,
+    source_ip VARCHAR(45), -- set when grouped automatically by source
+    created_by VARCHAR(100), -- NULL when grouped automatically
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
 -- Alerts Table
 CREATE TABLE IF NOT EXISTS alerts (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
     prediction_id UUID REFERENCES threat_predictions(id) ON DELETE CASCADE,
+    threat_id UUID REFERENCES threats(id) ON DELETE CASCADE,
     severity VARCHAR(20) NOT NULL, -- 'low', 'medium', 'high', 'critical'
     status VARCHAR(20) DEFAULT 'new', -- 'new', 'acknowledged', 'resolved', 'false_positive'
     description TEXT,
@@ -78,13 +131,59 @@ CREATE TABLE IF NOT EXISTS alerts (
     acknowledged_by VARCHAR(100),
     resolved_at TIMESTAMP,
     resolved_by VARCHAR(100),
+    assigned_to VARCHAR(100), -- analyst triaging the alert
+    incident_id UUID REFERENCES incidents(id) ON DELETE SET NULL,
     notes TEXT,
+    occurrence_count INTEGER NOT NULL DEFAULT 1, -- repeat detections folded into this alert
+    last_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP, -- soft delete; NULL while the alert is live
     CONSTRAINT check_severity CHECK (severity IN ('low', 'medium', 'high', 'critical')),
     CONSTRAINT check_status CHECK (status IN ('new', 'acknowledged', 'resolved', 'false_positive'))
 );
 
+-- Alert Audit Table (status change history)
+CREATE TABLE IF NOT EXISTS alert_audit (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    alert_id UUID NOT NULL REFERENCES alerts(id) ON DELETE CASCADE,
+    action VARCHAR(20) NOT NULL DEFAULT 'status_change', -- 'status_change', 'escalation', 'assignment', 'deletion', 'restore'
+    old_status VARCHAR(20),
+    new_status VARCHAR(20) NOT NULL,
+    old_severity VARCHAR(20), -- set on escalations
+    new_severity VARCHAR(20),
+    old_assignee VARCHAR(100), -- set on assignments
+    new_assignee VARCHAR(100),
+    changed_by VARCHAR(100) NOT NULL, -- identity of the API key that made the change
+    changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Threat Audit Table (verdict changes from re-analysis and committed replays)
+CREATE TABLE IF NOT EXISTS threat_audit (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    threat_id UUID NOT NULL REFERENCES threats(id) ON DELETE CASCADE,
+    action VARCHAR(20) NOT NULL, -- 'reanalysis', 'replay'
+    old_label VARCHAR(20) NOT NULL,
+    new_label VARCHAR(20) NOT NULL,
+    old_threat_type VARCHAR(50),
+    new_threat_type VARCHAR(50),
+    old_confidence FLOAT NOT NULL,
+    new_confidence FLOAT NOT NULL,
+    changed_by VARCHAR(100) NOT NULL,
+    changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Admin Audit Table (changes made through admin-scoped endpoints)
+CREATE TABLE IF NOT EXISTS admin_audit (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+    action VARCHAR(50) NOT NULL, -- 'purge', 'key_rotation', 'analyze_replay', 'rule_toggle'
+    target TEXT, -- e.g. the rotated key's id
+    details JSONB NOT NULL DEFAULT '{}',
+    actor VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
 -- System Metrics Table
 CREATE TABLE IF NOT EXISTS system_metrics (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -100,10 +199,86 @@ CREATE TABLE IF NOT EXISTS api_keys (
     key_hash VARCHAR(255) UNIQUE NOT NULL,
     name VARCHAR(100) NOT NULL,
     description TEXT,
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default', -- data visible to this key
+    scopes TEXT[] NOT NULL DEFAULT '{read}', -- 'read', 'write', 'admin', 'forensics'
     is_active BOOLEAN DEFAULT TRUE,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    request_count BIGINT NOT NULL DEFAULT 0, -- flushed periodically from Redis by the gateway
     last_used_at TIMESTAMP,
-    expires_at TIMESTAMP
+    expires_at TIMESTAMP,
+    rotated_at TIMESTAMP,
+    previous_key_hash VARCHAR(255) UNIQUE, -- replaced secret, still accepted until previous_key_expires_at
+    previous_key_expires_at TIMESTAMP
+);
+
+-- Scoring rules evaluated by the api-gateway's /analyze. A rule adds its
+-- weight to the threat score when all of its conditions match.
+CREATE TABLE IF NOT EXISTS scoring_rules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(100) UNIQUE NOT NULL,
+    threat_type VARCHAR(50) NOT NULL,
+    conditions JSONB NOT NULL, -- [{"field": "bytes", "operator": "gte", "value": 100}, ...]
+    weight FLOAT NOT NULL,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT check_rule_weight CHECK (weight >= 0 AND weight <= 1)
+);
+
+-- Source IP allow/deny lists applied at ingestion
+CREATE TABLE IF NOT EXISTS ip_lists (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+    cidr CIDR NOT NULL,
+    list_type VARCHAR(10) NOT NULL, -- 'allow', 'deny'
+    reason TEXT,
+    created_by VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT check_ip_list_type CHECK (list_type IN ('allow', 'deny')),
+    CONSTRAINT unique_ip_list_entry UNIQUE (tenant_id, cidr, list_type)
+);
+
+-- Records rejected at ingestion (invalid or denylisted), kept for inspection
+-- and replay via /ingest/rejected
+CREATE TABLE IF NOT EXISTS traffic_rejected (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+    endpoint VARCHAR(20) NOT NULL, -- 'ingest', 'batch', 'stream'
+    schema_version SMALLINT NOT NULL DEFAULT 1, -- default version the payload was decoded with
+    payload JSONB NOT NULL,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    replayed_at TIMESTAMP
+);
+
+-- Outbound webhooks notified when an alert at or above min_severity is raised
+CREATE TABLE IF NOT EXISTS webhooks (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+    url TEXT NOT NULL,
+    secret TEXT, -- HMAC-SHA256 key for the X-Webhook-Signature header
+    min_severity VARCHAR(20) NOT NULL DEFAULT 'high',
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT check_webhook_min_severity CHECK (min_severity IN ('low', 'medium', 'high', 'critical'))
+);
+
+-- False-positive feedback: traffic signatures analysts marked as false
+-- positives, down-weighted when scored again
+CREATE TABLE IF NOT EXISTS feedback (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+    source_ip VARCHAR(45) NOT NULL,
+    protocol VARCHAR(10) NOT NULL,
+    dest_port INTEGER NOT NULL, -- 0 when the traffic had none
+    threat_type VARCHAR(50) NOT NULL,
+    false_positive_count INTEGER NOT NULL DEFAULT 1, -- alerts of the signature marked false_positive
+    last_alert_id UUID REFERENCES alerts(id) ON DELETE SET NULL,
+    marked_by VARCHAR(100) NOT NULL, -- who marked the last one
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT unique_feedback_signature UNIQUE (tenant_id, source_ip, protocol, dest_port, threat_type)
 );
 
 -- Indexes for performance
@@ -111,11 +286,29 @@ CREATE INDEX IF NOT EXISTS idx_traffic_created_at ON network_traffic(created_at
 CREATE INDEX IF NOT EXISTS idx_predictions_traffic_id ON threat_predictions(traffic_id);
 CREATE INDEX IF NOT EXISTS idx_predictions_created_at ON threat_predictions(created_at DESC);
 CREATE INDEX IF NOT EXISTS idx_predictions_prediction ON threat_predictions(prediction);
+CREATE INDEX IF NOT EXISTS idx_traffic_received_at ON traffic(received_at DESC);
+CREATE INDEX IF NOT EXISTS idx_threats_created_at ON threats(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_threats_label ON threats(label);
+CREATE INDEX IF NOT EXISTS idx_threats_source_ip ON threats(source_ip);
+CREATE INDEX IF NOT EXISTS idx_alerts_threat_id ON alerts(threat_id);
 CREATE INDEX IF NOT EXISTS idx_alerts_status ON alerts(status);
 CREATE INDEX IF NOT EXISTS idx_alerts_severity ON alerts(severity);
+CREATE INDEX IF NOT EXISTS idx_alerts_assigned_to ON alerts(assigned_to);
+CREATE INDEX IF NOT EXISTS idx_alerts_incident_id ON alerts(incident_id);
 CREATE INDEX IF NOT EXISTS idx_alerts_created_at ON alerts(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_traffic_tenant_country ON traffic(tenant_id, country);
+CREATE INDEX IF NOT EXISTS idx_traffic_tenant_received_at ON traffic(tenant_id, received_at DESC);
+CREATE INDEX IF NOT EXISTS idx_threats_tenant_created_at ON threats(tenant_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_alerts_tenant_created_at ON alerts(tenant_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_alerts_tenant_source_last_seen ON alerts(tenant_id, source_ip, last_seen_at DESC);
+CREATE INDEX IF NOT EXISTS idx_alert_audit_alert_id ON alert_audit(alert_id, changed_at DESC);
+CREATE INDEX IF NOT EXISTS idx_threat_audit_threat_id ON threat_audit(threat_id, changed_at);
+CREATE INDEX IF NOT EXISTS idx_admin_audit_tenant_created_at ON admin_audit(tenant_id, created_at);
 CREATE INDEX IF NOT EXISTS idx_metrics_type_created ON system_metrics(metric_type, created_at DESC);
 CREATE INDEX IF NOT EXISTS idx_api_keys_hash ON api_keys(key_hash);
+CREATE INDEX IF NOT EXISTS idx_webhooks_tenant ON webhooks(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_incidents_tenant_source ON incidents(tenant_id, source_ip);
+CREATE INDEX IF NOT EXISTS idx_traffic_rejected_tenant_created_at ON traffic_rejected(tenant_id, created_at DESC);
 
 -- Function to update updated_at timestamp
 CREATE OR REPLACE FUNCTION update_updated_at_column()
@@ -127,13 +320,35 @@ END;
 $$ language 'plpgsql';
 
 -- Trigger for alerts table
-CREATE TRIGGER update_alerts_updated_at BEFORE UPDATE ON alerts
+CREATE OR REPLACE TRIGGER update_alerts_updated_at BEFORE UPDATE ON alerts
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Trigger for threats table
+CREATE OR REPLACE TRIGGER update_threats_updated_at BEFORE UPDATE ON threats
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Trigger for incidents table
+CREATE OR REPLACE TRIGGER update_incidents_updated_at BEFORE UPDATE ON incidents
     FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 
+-- Trigger for scoring_rules table
+CREATE OR REPLACE TRIGGER update_scoring_rules_updated_at BEFORE UPDATE ON scoring_rules
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Default scoring rules (the same rules the gateway falls back to when this
+-- table is empty). Their thresholds are fixed here; ANALYZE_DOS_PACKET_RATE
+-- and ANALYZE_LARGE_TRANSFER_BYTES only configure the fallback copies.
+INSERT INTO scoring_rules (name, threat_type, conditions, weight) VALUES
+    ('packet-flood', 'DoS', '[{"field": "packet_rate", "operator": "gte", "value": 1000}]', 0.6),
+    ('port-probe', 'Probe', '[{"field": "packet_count", "operator": "lte", "value": 3}, {"field": "bytes", "operator": "lt", "value": 100}]', 0.4),
+    ('remote-access-port', 'R2L', '[{"field": "dest_port", "operator": "in", "value": [21, 22, 23, 445, 3389]}]', 0.3),
+    ('large-transfer', 'R2L', '[{"field": "bytes", "operator": "gte", "value": 10485760}]', 0.3)
+ON CONFLICT (name) DO NOTHING;
+
 -- Insert sample API key for development (key: dev-api-key-12345)
--- Hash is just for demo - in production use proper bcrypt
-INSERT INTO api_keys (key_hash, name, description) 
-VALUES ('dev-api-key-12345', 'Development Key', 'Default API key for local development')
+-- key_hash is the hex-encoded SHA-256 of the key; plaintext keys are never stored
+INSERT INTO api_keys (key_hash, name, description, scopes)
+VALUES ('8264dc9f07e749d9c2ffead0b25de8cb22bed7af774e189ef224ae015908776b', 'Development Key', 'Default API key for local development', '{read,write}')
 ON CONFLICT (key_hash) DO NOTHING;
 
 -- Sample view for threat statistics
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// asyncBatchSize is how many queued records the consumer inserts per
+	// statement.
+	asyncBatchSize = 100
+
+	asyncInsertTimeout = 30 * time.Second
+)
+
+// asyncQueueKey is the Redis list ?mode=async records are pushed onto.
+var asyncQueueKey = "ingest:queue"
+
+// asyncJob is a validated record waiting in asyncQueueKey. The label and
+// sample rate are carried separately because TrafficRecord doesn't serialize
+// them.
+type asyncJob struct {
+	TenantID   string        `json:"tenant_id"`
+	Label      string        `json:"label,omitempty"`
+	SampleRate float64       `json:"sample_rate,omitempty"`
+	Record     TrafficRecord `json:"record"`
+}
+
+// enqueueTraffic queues an already validated record for runAsyncIngestWorker.
+func enqueueTraffic(c *gin.Context, tenant string, record TrafficRecord) error {
+	payload, err := json.Marshal(asyncJob{TenantID: tenant, Label: record.Label, SampleRate: record.SampleRate, Record: record})
+	if err != nil {
+		return err
+	}
+	return redisClient.LPush(c.Request.Context(), asyncQueueKey, payload).Err()
+}
+
+// runAsyncIngestWorker drains asyncQueueKey into the traffic table until ctx
+// is cancelled. Records are inserted in batches of up to asyncBatchSize; a
+// batch that fails to insert goes back to the head of the queue, so records
+// are only lost if Redis itself loses them.
+func runAsyncIngestWorker(ctx context.Context) {
+	for ctx.Err() == nil {
+		res, err := redisClient.BRPop(ctx, 5*time.Second, asyncQueueKey).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Warn("Failed to read ingest queue", "error", err)
+			sleepCtx(ctx, time.Second)
+			continue
+		}
+
+		payloads := []string{res[1]}
+		more, err := redisClient.RPopCount(ctx, asyncQueueKey, asyncBatchSize-1).Result()
+		if err != nil && err != redis.Nil {
+			slog.Warn("Failed to read ingest queue", "error", err)
+		}
+		payloads = append(payloads, more...)
+
+		if err := insertQueuedTraffic(payloads); err != nil {
+			slog.Warn("Failed to insert queued traffic, requeueing", "records", len(payloads), "error", err)
+			// RPUSH in reverse restores the original order at the head.
+			requeue := make([]interface{}, 0, len(payloads))
+			for i := len(payloads) - 1; i >= 0; i-- {
+				requeue = append(requeue, payloads[i])
+			}
+			if err := redisClient.RPush(context.Background(), asyncQueueKey, requeue...).Err(); err != nil {
+				slog.Error("Failed to requeue traffic, records lost", "records", len(payloads), "error", err)
+			}
+			sleepCtx(ctx, time.Second)
+		}
+	}
+}
+
+// insertQueuedTraffic decodes queued jobs and inserts them per tenant. It runs
+// on its own deadline so a batch already popped is still written during
+// shutdown.
+func insertQueuedTraffic(payloads []string) error {
+	byTenant := map[string][]TrafficRecord{}
+	for _, p := range payloads {
+		var job asyncJob
+		if err := json.Unmarshal([]byte(p), &job); err != nil || job.Record.DestPort == nil || job.Record.Bytes == nil || job.Record.PacketCount == nil {
+			slog.Warn("Dropping malformed queued traffic record", "error", err)
+			continue
+		}
+		job.Record.Label = job.Label
+		job.Record.SampleRate = job.SampleRate
+		byTenant[job.TenantID] = append(byTenant[job.TenantID], job.Record)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), asyncInsertTimeout)
+	defer cancel()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	accepted := 0
+	for tenant, records := range byTenant {
+		if storeInPostgres {
+			if err := insertTrafficTx(ctx, tx, tenant, records); err != nil {
+				return err
+			}
+		}
+		accepted += len(records)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	// Retrying after the commit would duplicate the rows in Postgres, so a
+	// sink that misses the batch is only logged.
+	for tenant, records := range byTenant {
+		if err := forwardTraffic(ctx, tenant, records); err != nil {
+			slog.Warn("Failed to forward queued traffic", "tenant_id", tenant, "records", len(records), "error", err)
+		}
+	}
+	ingestRecordsTotal.WithLabelValues("accepted").Add(float64(accepted))
+	return nil
+}
+
+// asyncQueueDepth reports the queue length for the ingest_queue_depth gauge,
+// or -1 when Redis can't be reached.
+func asyncQueueDepth() float64 {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	n, err := redisClient.LLen(ctx, asyncQueueKey).Result()
+	if err != nil {
+		return -1
+	}
+	return float64(n)
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
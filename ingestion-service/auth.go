@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+)
+
+// APIKey is the authenticated agent identity attached to the request context.
+// Its JSON form matches the api-gateway's, so both services share the
+// "apikey:<hash>" cache entries.
+type APIKey struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	TenantID string   `json:"tenant_id"`
+	Scopes   []string `json:"scopes"`
+}
+
+// apiKeyCacheTTL bounds how long a key lookup (including a miss) is served
+// from Redis, and therefore how long a revoked key may keep working.
+var apiKeyCacheTTL = 5 * time.Minute
+
+// apiKeyAuthMiddleware requires an X-API-Key with the "write" scope and
+// attaches its tenant, which every ingested record is stamped with.
+func apiKeyAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiKey := c.GetHeader("X-API-Key")
+		if apiKey == "" {
+			c.JSON(401, gin.H{"error": "Unauthorized - Invalid or missing API key"})
+			c.Abort()
+			return
+		}
+
+		sum := sha256.Sum256([]byte(apiKey))
+		key, err := lookupAPIKey(c, hex.EncodeToString(sum[:]))
+		if err != nil {
+			requestLog(c).Error("Failed to look up API key", "error", err)
+			internalError(c, "failed to authenticate request")
+			c.Abort()
+			return
+		}
+		if key == nil {
+			c.JSON(401, gin.H{"error": "Unauthorized - Invalid or missing API key"})
+			c.Abort()
+			return
+		}
+		if !contains(key.Scopes, "write") {
+			c.JSON(403, gin.H{"error": "Forbidden - credentials lack the 'write' scope"})
+			c.Abort()
+			return
+		}
+
+		c.Set("api_key", key)
+		c.Set("tenant_id", key.TenantID)
+		recordKeyUsage(c, key.ID)
+		c.Next()
+	}
+}
+
+// recordKeyUsage counts one request for the key in the usage hashes the API
+// gateway periodically flushes into api_keys. Failures only cost accuracy, so
+// they are logged and otherwise ignored.
+func recordKeyUsage(c *gin.Context, keyID string) {
+	_, err := redisClient.Pipelined(c.Request.Context(), func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(c.Request.Context(), "apikey:usage:counts", keyID, 1)
+		pipe.HSet(c.Request.Context(), "apikey:usage:last_used", keyID, time.Now().Unix())
+		return nil
+	})
+	if err != nil {
+		requestLog(c).Warn("Failed to record API key usage", "key_id", keyID, "error", err)
+	}
+}
+
+// lookupAPIKey resolves a key hash to an active key, consulting Redis before
+// Postgres. A nil key with a nil error means the key is unknown, inactive or
+// expired; misses are cached as an empty value.
+func lookupAPIKey(c *gin.Context, keyHash string) (*APIKey, error) {
+	ctx := c.Request.Context()
+	cacheKey := "apikey:" + keyHash
+
+	if cached, err := redisClient.Get(ctx, cacheKey).Bytes(); err == nil {
+		if len(cached) == 0 {
+			return nil, nil
+		}
+		var key APIKey
+		if err := json.Unmarshal(cached, &key); err == nil {
+			return &key, nil
+		}
+	} else if err != redis.Nil {
+		requestLog(c).Warn("Failed to read API key cache", "error", err)
+	}
+
+	// A rotated key's previous secret also matches until its grace period
+	// ends; graceEnd is only set in that case.
+	var key APIKey
+	var graceEnd *time.Time
+	err := db.QueryRowContext(ctx, `SELECT id, name, tenant_id, scopes,
+			CASE WHEN key_hash = $1 THEN NULL ELSE previous_key_expires_at END
+		FROM api_keys
+		WHERE (key_hash = $1 OR (previous_key_hash = $1 AND previous_key_expires_at > LOCALTIMESTAMP))
+			AND is_active AND (expires_at IS NULL OR expires_at > LOCALTIMESTAMP)`,
+		keyHash,
+	).Scan(&key.ID, &key.Name, &key.TenantID, pq.Array(&key.Scopes), &graceEnd)
+
+	var payload []byte
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return nil, err
+	default:
+		payload, _ = json.Marshal(key)
+	}
+
+	ttl := apiKeyCacheTTL
+	if graceEnd != nil {
+		// Never 0, which Redis would take as no expiry at all.
+		ttl = min(ttl, max(time.Until(*graceEnd), time.Millisecond))
+	}
+	if err := redisClient.Set(ctx, cacheKey, payload, ttl).Err(); err != nil {
+		requestLog(c).Warn("Failed to write API key cache", "error", err)
+	}
+
+	if payload == nil {
+		return nil, nil
+	}
+	return &key, nil
+}
+
+// tenantFromContext returns the tenant of the authenticated API key.
+func tenantFromContext(c *gin.Context) string {
+	return c.GetString("tenant_id")
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBodySize rejects requests whose body is larger than limit bytes with a
+// 413. Declared lengths are checked up front; chunked bodies are capped with
+// http.MaxBytesReader and surface as a bind error the handler turns into 413.
+func maxBodySize(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > limit {
+			c.JSON(413, gin.H{"error": fmt.Sprintf("request body exceeds the maximum of %d bytes", limit)})
+			c.Abort()
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// isBodyTooLarge reports whether err came from reading past a maxBodySize limit.
+func isBodyTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
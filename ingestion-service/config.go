@@ -0,0 +1,95 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getEnv returns the value of key, or fallback when it is unset or empty.
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// getEnvInt is like getEnv for integers. Unparseable values are logged and
+// replaced by the fallback so a typo doesn't stop the service from starting.
+func getEnvInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("Invalid %s=%q, using default %d", key, v, fallback)
+		return fallback
+	}
+	return n
+}
+
+// getEnvFloat is like getEnvInt for floating point values.
+func getEnvFloat(key string, fallback float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Printf("Invalid %s=%q, using default %g", key, v, fallback)
+		return fallback
+	}
+	return f
+}
+
+// getEnvDuration is like getEnvInt for time.Duration values such as "10s".
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("Invalid %s=%q, using default %s", key, v, fallback)
+		return fallback
+	}
+	return d
+}
+
+// getEnvBool is like getEnvInt for booleans ("true", "1", "false", ...).
+func getEnvBool(key string, fallback bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("Invalid %s=%q, using default %t", key, v, fallback)
+		return fallback
+	}
+	return b
+}
+
+// defaultTrustedProxies covers loopback and the private ranges a load balancer
+// or the compose network would connect from.
+const defaultTrustedProxies = "127.0.0.0/8,::1/128,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,fc00::/7"
+
+// trustedProxies returns the TRUSTED_PROXIES CIDRs/IPs whose X-Forwarded-For
+// headers c.ClientIP() honours. "none" trusts no proxy, so the client IP is
+// always the connection's peer address.
+func trustedProxies() []string {
+	v := getEnv("TRUSTED_PROXIES", defaultTrustedProxies)
+	if v == "none" {
+		return nil
+	}
+	var proxies []string
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
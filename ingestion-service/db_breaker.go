@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sony/gobreaker"
+)
+
+// dbBreaker trips after DB_BREAKER_FAILURE_THRESHOLD consecutive database
+// failures and then fails every query immediately for DB_BREAKER_COOLDOWN,
+// so an overloaded Postgres isn't buried under retries, before letting a
+// single probe through. It stays nil, and every query passes, until
+// initDB has connected, so the startup retries can't trip it.
+var dbBreaker *gobreaker.TwoStepCircuitBreaker
+
+var dbBreakerCooldown = 30 * time.Second
+
+// The gauge reads dbBreaker at scrape time: 0 closed, 1 half-open, 2 open.
+var _ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+	Name: "db_circuit_breaker_state",
+	Help: "State of the database circuit breaker: 0 closed, 1 half-open, 2 open.",
+}, func() float64 {
+	if dbBreaker == nil {
+		return 0
+	}
+	return float64(dbBreaker.State())
+})
+
+// initDBBreaker creates dbBreaker. A threshold of 0 disables it.
+func initDBBreaker() {
+	threshold := getEnvInt("DB_BREAKER_FAILURE_THRESHOLD", 5)
+	if threshold <= 0 {
+		return
+	}
+	dbBreakerCooldown = getEnvDuration("DB_BREAKER_COOLDOWN", dbBreakerCooldown)
+	dbBreaker = gobreaker.NewTwoStepCircuitBreaker(gobreaker.Settings{
+		Name:    "database",
+		Timeout: dbBreakerCooldown,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return counts.ConsecutiveFailures >= uint32(threshold)
+		},
+		OnStateChange: func(name string, from, to gobreaker.State) {
+			slog.Warn("Database circuit breaker changed state", "from", from.String(), "to", to.String())
+		},
+	})
+}
+
+// dbBreakerOpen reports whether database calls are currently being refused.
+func dbBreakerOpen() bool {
+	return dbBreaker != nil && dbBreaker.State() == gobreaker.StateOpen
+}
+
+// dbBreakerState is the breaker state shown by the readiness check.
+func dbBreakerState() string {
+	if dbBreaker == nil {
+		return "disabled"
+	}
+	return dbBreaker.State().String()
+}
+
+// dbUnavailable answers 503 while the breaker is open or probing, telling the
+// client when to retry.
+func dbUnavailable(c *gin.Context) {
+	c.Header("Retry-After", strconv.Itoa(int(dbBreakerCooldown.Seconds())))
+	c.JSON(503, gin.H{"error": "database unavailable, retry shortly"})
+}
+
+// dbBreakerMiddleware rejects requests with a 503 while the breaker is open,
+// before they reach a handler that would only fail on its first query.
+func dbBreakerMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if dbBreakerOpen() {
+			dbUnavailable(c)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// dbFailed reports whether err means the database is unhealthy, as opposed to
+// a statement it rejected (a constraint violation, bad input) or a caller
+// that gave up. Only the former counts toward tripping the breaker.
+func dbFailed(ctx context.Context, err error) bool {
+	if err == nil || errors.Is(ctx.Err(), context.Canceled) {
+		return false
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "08", "53", "57", "58", "XX": // connection, resources, operator intervention (incl. statement_timeout), system, internal
+			return true
+		}
+		return errors.Is(ctx.Err(), context.DeadlineExceeded)
+	}
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) || errors.As(err, &netErr) || errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
+
+// guardDB runs op if the breaker allows it and reports its outcome.
+func guardDB(ctx context.Context, op func() error) error {
+	if dbBreaker == nil {
+		return op()
+	}
+	done, err := dbBreaker.Allow()
+	if err != nil {
+		return fmt.Errorf("database circuit breaker: %w", err)
+	}
+	err = op()
+	done(!dbFailed(ctx, err))
+	return err
+}
+
+// breakerConnector wraps the lib/pq connector so that every connection,
+// query, statement and transaction goes through guardDB, whichever code path
+// issues it.
+type breakerConnector struct {
+	driver.Connector
+}
+
+// pqConn is the set of driver interfaces lib/pq connections implement and
+// breakerConn passes through.
+type pqConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+func (bc breakerConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	var conn driver.Conn
+	err := guardDB(ctx, func() (err error) {
+		conn, err = bc.Connector.Connect(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	pc, ok := conn.(pqConn)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("database driver connection %T is not supported", conn)
+	}
+	return breakerConn{pc}, nil
+}
+
+type breakerConn struct {
+	pqConn
+}
+
+func (bc breakerConn) BeginTx(ctx context.Context, opts driver.TxOptions) (tx driver.Tx, err error) {
+	err = guardDB(ctx, func() error {
+		tx, err = bc.pqConn.BeginTx(ctx, opts)
+		return err
+	})
+	return tx, err
+}
+
+func (bc breakerConn) PrepareContext(ctx context.Context, query string) (stmt driver.Stmt, err error) {
+	err = guardDB(ctx, func() error {
+		stmt, err = bc.pqConn.PrepareContext(ctx, query)
+		return err
+	})
+	return stmt, err
+}
+
+func (bc breakerConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (result driver.Result, err error) {
+	err = guardDB(ctx, func() error {
+		result, err = bc.pqConn.ExecContext(ctx, query, args)
+		return err
+	})
+	return result, err
+}
+
+func (bc breakerConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (rows driver.Rows, err error) {
+	err = guardDB(ctx, func() error {
+		rows, err = bc.pqConn.QueryContext(ctx, query, args)
+		return err
+	})
+	return rows, err
+}
+
+func (bc breakerConn) Ping(ctx context.Context) error {
+	return guardDB(ctx, func() error { return bc.pqConn.Ping(ctx) })
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// dedupTTL is how long a completed ingest response is remembered for replay.
+var dedupTTL = 10 * time.Minute
+
+const dedupPending = "pending"
+
+// storedResponse is what gets cached for a completed idempotent request.
+type storedResponse struct {
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body"`
+}
+
+// beginIdempotent claims the idempotency key for this request, taken from the
+// Idempotency-Key header or, failing that, a hash of payload. If the key was
+// already used within dedupTTL the original response is replayed (or a 409
+// sent while the first attempt is still running) and done is true. The
+// returned key is empty when deduplication is unavailable.
+func beginIdempotent(c *gin.Context, scope string, payload []byte) (key string, done bool) {
+	id := c.GetHeader("Idempotency-Key")
+	if id == "" {
+		sum := sha256.Sum256(payload)
+		id = hex.EncodeToString(sum[:])
+	}
+	key = "idempotency:" + scope + ":" + id
+
+	ctx := c.Request.Context()
+	claimed, err := redisClient.SetNX(ctx, key, dedupPending, dedupTTL).Result()
+	if err != nil {
+		requestLog(c).Warn("Deduplication unavailable, processing request", "error", err)
+		return "", false
+	}
+	if claimed {
+		return key, false
+	}
+
+	cached, err := redisClient.Get(ctx, key).Result()
+	if err == redis.Nil {
+		// Expired between SETNX and GET; treat as new.
+		return beginIdempotent(c, scope, payload)
+	}
+	if err != nil {
+		requestLog(c).Warn("Deduplication unavailable, processing request", "error", err)
+		return "", false
+	}
+	if cached == dedupPending {
+		respondIngest(c, 409, gin.H{"error": "a request with this idempotency key is already being processed"})
+		return key, true
+	}
+
+	var stored storedResponse
+	if err := json.Unmarshal([]byte(cached), &stored); err != nil {
+		requestLog(c).Warn("Discarding unreadable idempotency record", "error", err)
+		redisClient.Del(ctx, key)
+		return beginIdempotent(c, scope, payload)
+	}
+	c.Header("Idempotent-Replayed", "true")
+	writeIngestResponse(c, stored.Status, stored.Body)
+	return key, true
+}
+
+// completeIdempotent stores the response so retries within dedupTTL are
+// answered without touching the database again.
+func completeIdempotent(c *gin.Context, key string, status int, body gin.H) {
+	if key == "" {
+		return
+	}
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+	payload, _ := json.Marshal(storedResponse{Status: status, Body: encoded})
+	if err := redisClient.Set(c.Request.Context(), key, payload, redis.KeepTTL).Err(); err != nil {
+		requestLog(c).Warn("Failed to store idempotency record", "error", err)
+	}
+}
+
+// abandonIdempotent releases a claimed key after a failure so the client can
+// retry.
+func abandonIdempotent(c *gin.Context, key string) {
+	if key == "" {
+		return
+	}
+	if err := redisClient.Del(c.Request.Context(), key).Err(); err != nil {
+		requestLog(c).Warn("Failed to release idempotency key", "error", err)
+	}
+}
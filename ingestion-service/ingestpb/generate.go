@@ -0,0 +1,4 @@
+// Package ingestpb holds the protobuf messages of the ingestion API.
+package ingestpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative ingest.proto
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// ipListCacheTTL bounds how long a tenant's allow/deny lists are served from
+// Redis. The api-gateway deletes the cached copy when the lists change.
+var ipListCacheTTL = time.Minute
+
+// ipListEntry is one row of the ip_lists table.
+type ipListEntry struct {
+	CIDR     string  `json:"cidr"`
+	ListType string  `json:"list_type"`
+	Reason   *string `json:"reason"`
+
+	network *net.IPNet
+}
+
+// ipLists is a tenant's allow and deny entries.
+type ipLists []ipListEntry
+
+// loadIPLists returns the authenticated tenant's lists, consulting Redis
+// before Postgres.
+func loadIPLists(c *gin.Context) (ipLists, error) {
+	ctx := c.Request.Context()
+	tenant := tenantFromContext(c)
+	cacheKey := "iplists:" + tenant
+
+	var entries []ipListEntry
+	if cached, err := redisClient.Get(ctx, cacheKey).Bytes(); err == nil {
+		if err := json.Unmarshal(cached, &entries); err == nil {
+			return parseIPLists(c, entries), nil
+		}
+	} else if err != redis.Nil {
+		requestLog(c).Warn("Failed to read IP list cache", "error", err)
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT cidr, list_type, reason FROM ip_lists WHERE tenant_id = $1", tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries = []ipListEntry{}
+	for rows.Next() {
+		var e ipListEntry
+		if err := rows.Scan(&e.CIDR, &e.ListType, &e.Reason); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if payload, err := json.Marshal(entries); err == nil {
+		if err := redisClient.Set(ctx, cacheKey, payload, ipListCacheTTL).Err(); err != nil {
+			requestLog(c).Warn("Failed to write IP list cache", "error", err)
+		}
+	}
+	return parseIPLists(c, entries), nil
+}
+
+func parseIPLists(c *gin.Context, entries []ipListEntry) ipLists {
+	lists := make(ipLists, 0, len(entries))
+	for _, e := range entries {
+		_, network, err := net.ParseCIDR(e.CIDR)
+		if err != nil {
+			requestLog(c).Warn("Skipping invalid IP list entry", "cidr", e.CIDR, "error", err)
+			continue
+		}
+		e.network = network
+		lists = append(lists, e)
+	}
+	return lists
+}
+
+// match returns the entry whose network contains ip, or nil if there is none.
+// Deny entries win over overlapping allow entries.
+func (l ipLists) match(ip string) *ipListEntry {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil
+	}
+	var found *ipListEntry
+	for i := range l {
+		if !l[i].network.Contains(addr) {
+			continue
+		}
+		if l[i].ListType == "deny" {
+			return &l[i]
+		}
+		if found == nil {
+			found = &l[i]
+		}
+	}
+	return found
+}
+
+// denyReason is the client-facing explanation for a denylisted source.
+func (e *ipListEntry) denyReason() string {
+	if e.Reason != nil && *e.Reason != "" {
+		return *e.Reason
+	}
+	return "source " + e.CIDR + " is denylisted"
+}
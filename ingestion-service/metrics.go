@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests processed, by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency, by method, route and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	ingestRecordsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ingest_records_total",
+		Help: "Traffic records received by the ingestion endpoints, by result (accepted, rejected, sampled_out, or failed when their chunk of a batch failed to insert).",
+	}, []string{"result"})
+
+	// Evaluated at scrape time; a growing value means the async consumer
+	// can't keep up.
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "ingest_queue_depth",
+		Help: "Traffic records waiting in the ?mode=async ingest queue (-1 if Redis is unreachable).",
+	}, asyncQueueDepth)
+)
+
+// metricsMiddleware records request count and latency for every handler. The
+// route template (e.g. /api/v1/alerts/:id) is used as the label rather than
+// the raw path to keep label cardinality bounded.
+func metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		httpRequestsTotal.WithLabelValues(c.Request.Method, route, status).Inc()
+		httpRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// metricsHandler serves the Prometheus scrape endpoint.
+func metricsHandler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
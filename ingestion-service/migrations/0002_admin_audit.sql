@@ -0,0 +1,12 @@
+-- Admin Audit Table (changes made through admin-scoped endpoints)
+CREATE TABLE IF NOT EXISTS admin_audit (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+    action VARCHAR(50) NOT NULL, -- 'purge', 'key_rotation', 'analyze_replay'
+    target TEXT, -- e.g. the rotated key's id
+    details JSONB NOT NULL DEFAULT '{}',
+    actor VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_admin_audit_tenant_created_at ON admin_audit(tenant_id, created_at);
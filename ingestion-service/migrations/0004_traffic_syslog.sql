@@ -0,0 +1,3 @@
+-- Syslog fields of traffic records ingested through /ingest/syslog
+ALTER TABLE traffic ADD COLUMN IF NOT EXISTS syslog_severity SMALLINT; -- 0 (emergency) to 7 (debug); NULL for records not received as syslog
+ALTER TABLE traffic ADD COLUMN IF NOT EXISTS message TEXT; -- syslog message text, truncated
@@ -0,0 +1,16 @@
+-- False-positive feedback: traffic signatures analysts marked as false
+-- positives, down-weighted when scored again
+CREATE TABLE IF NOT EXISTS feedback (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+    source_ip VARCHAR(45) NOT NULL,
+    protocol VARCHAR(10) NOT NULL,
+    dest_port INTEGER NOT NULL, -- 0 when the traffic had none
+    threat_type VARCHAR(50) NOT NULL,
+    false_positive_count INTEGER NOT NULL DEFAULT 1, -- alerts of the signature marked false_positive
+    last_alert_id UUID REFERENCES alerts(id) ON DELETE SET NULL,
+    marked_by VARCHAR(100) NOT NULL, -- who marked the last one
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT unique_feedback_signature UNIQUE (tenant_id, source_ip, protocol, dest_port, threat_type)
+);
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/yourusername/threat-detector/ingestion-service/ingestpb"
+)
+
+// Media types of the ingestpb messages. The x- form is what older protobuf
+// clients send.
+const (
+	mimeProtobuf  = "application/protobuf"
+	mimeXProtobuf = "application/x-protobuf"
+)
+
+func isProtobuf(contentType string) bool {
+	return contentType == mimeProtobuf || contentType == mimeXProtobuf
+}
+
+// readProtobuf decodes the request body into m. Reading through the body
+// limit means an oversized body still fails with isBodyTooLarge.
+func readProtobuf(c *gin.Context, m proto.Message) error {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(body, m)
+}
+
+// bindTrafficRecord reads the body of POST /ingest as JSON or, with a
+// protobuf Content-Type, as an ingestpb.TrafficRecord. Either way the record
+// comes back as JSON so both formats share decoding, validation, idempotency
+// and the dead-letter store.
+func bindTrafficRecord(c *gin.Context) (json.RawMessage, error) {
+	if !isProtobuf(c.ContentType()) {
+		var raw json.RawMessage
+		err := c.ShouldBindJSON(&raw)
+		return raw, err
+	}
+	var m ingestpb.TrafficRecord
+	if err := readProtobuf(c, &m); err != nil {
+		return nil, err
+	}
+	return trafficRecordJSON(&m), nil
+}
+
+// bindTrafficBatch is bindTrafficRecord for POST /ingest/batch, whose
+// protobuf body is an ingestpb.TrafficBatch.
+func bindTrafficBatch(c *gin.Context) ([]json.RawMessage, error) {
+	if !isProtobuf(c.ContentType()) {
+		var raw []json.RawMessage
+		if err := c.ShouldBindJSON(&raw); err != nil {
+			if isBodyTooLarge(err) {
+				return nil, err
+			}
+			return nil, errors.New("expected a JSON array of traffic records")
+		}
+		return raw, nil
+	}
+	var m ingestpb.TrafficBatch
+	if err := readProtobuf(c, &m); err != nil {
+		if isBodyTooLarge(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("expected a TrafficBatch message: %w", err)
+	}
+	raw := make([]json.RawMessage, len(m.Records))
+	for i, r := range m.Records {
+		raw[i] = trafficRecordJSON(r)
+	}
+	return raw, nil
+}
+
+// trafficRecordJSON renders m in the JSON schema of TrafficRecord. Unset
+// optional fields are left out, so required ones fail validation exactly as
+// they would in a JSON body.
+func trafficRecordJSON(m *ingestpb.TrafficRecord) json.RawMessage {
+	fields := map[string]interface{}{
+		"source_ip": m.GetSourceIp(),
+		"protocol":  m.GetProtocol(),
+	}
+	if m.DestIp != "" {
+		fields["dest_ip"] = m.DestIp
+	}
+	if m.SourcePort != nil {
+		fields["source_port"] = *m.SourcePort
+	}
+	if m.DestPort != nil {
+		fields["dest_port"] = *m.DestPort
+	}
+	if m.Bytes != nil {
+		fields["bytes"] = *m.Bytes
+	}
+	if m.PacketCount != nil {
+		fields["packet_count"] = *m.PacketCount
+	}
+	if m.Duration != nil {
+		fields["duration"] = *m.Duration
+	}
+	if m.SchemaVersion != nil {
+		fields["schema_version"] = *m.SchemaVersion
+	}
+	raw, _ := json.Marshal(fields)
+	return raw
+}
+
+// respondIngest writes an ingestion response as JSON or, when the Accept
+// header prefers protobuf, as an ingestpb.IngestResponse.
+func respondIngest(c *gin.Context, code int, body gin.H) {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		c.JSON(code, body)
+		return
+	}
+	writeIngestResponse(c, code, encoded)
+}
+
+var ingestResponseJSON = protojson.UnmarshalOptions{DiscardUnknown: true}
+
+// writeIngestResponse is respondIngest for a body that is already JSON, such
+// as a replayed idempotent response. JSON is the default when the client
+// states no preference.
+func writeIngestResponse(c *gin.Context, code int, body []byte) {
+	format := c.NegotiateFormat(gin.MIMEJSON, mimeProtobuf, mimeXProtobuf)
+	if isProtobuf(format) {
+		var m ingestpb.IngestResponse
+		if err := ingestResponseJSON.Unmarshal(body, &m); err == nil {
+			if encoded, err := proto.Marshal(&m); err == nil {
+				c.Data(code, format, encoded)
+				return
+			}
+		}
+		requestLog(c).Warn("Failed to encode protobuf response, answering with JSON")
+	}
+	c.Data(code, "application/json; charset=utf-8", body)
+}
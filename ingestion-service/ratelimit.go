@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const rateLimitWindow = time.Minute
+
+// slidingWindowScript keeps one sorted-set member per accepted request, scored
+// by its timestamp in milliseconds. Running it as a script makes the
+// check-and-add atomic across replicas. It returns {allowed, retry_after_ms}.
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', key, 0, now - window)
+if redis.call('ZCARD', key) >= limit then
+	local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+	return {0, tonumber(oldest[2]) + window - now}
+end
+
+redis.call('ZADD', key, now, ARGV[4])
+redis.call('PEXPIRE', key, window)
+return {1, 0}
+`)
+
+// rateLimitMiddleware throttles each API key to limitPerMinute requests over
+// a sliding one-minute window. It must run after apiKeyAuthMiddleware: keying
+// on anything the client controls, such as X-Agent-ID, would let a caller get
+// a fresh window by changing it. If Redis is unavailable requests are let
+// through rather than blocking ingestion entirely.
+func rateLimitMiddleware(limitPerMinute int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := "ratelimit:ingest:" + c.MustGet("api_key").(*APIKey).ID
+
+		now := time.Now().UnixMilli()
+		member := fmt.Sprintf("%d-%d", now, rand.Int63())
+		result, err := slidingWindowScript.Run(c.Request.Context(), redisClient, []string{key},
+			now, rateLimitWindow.Milliseconds(), limitPerMinute, member).Int64Slice()
+		if err != nil {
+			requestLog(c).Warn("Rate limiter unavailable, allowing request", "error", err)
+			c.Next()
+			return
+		}
+
+		if result[0] == 0 {
+			retryAfter := (result[1] + 999) / 1000 // round up to whole seconds
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+			c.JSON(429, gin.H{"error": "rate limit exceeded", "limit_per_minute": limitPerMinute})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultRejectedLimit = 100
+	maxRejectedLimit     = 1000
+	maxReplayIDs         = 500
+)
+
+// rejection is a record that failed validation or was denylisted, kept so it
+// can be inspected and replayed from the traffic_rejected table.
+type rejection struct {
+	Payload json.RawMessage
+	Reason  string
+}
+
+// storeRejected writes a request's rejected records to traffic_rejected under
+// the caller's tenant. version is the default schema version the request was
+// decoded with, so a replay decodes the payload the same way. Failures are
+// logged and otherwise ignored: the dead-letter store must not fail ingestion.
+func storeRejected(c *gin.Context, endpoint string, version int, rejections []rejection) {
+	if len(rejections) == 0 {
+		return
+	}
+	tenant := tenantFromContext(c)
+	placeholders := make([]string, 0, len(rejections))
+	args := make([]interface{}, 0, len(rejections)*5)
+	for i, r := range rejections {
+		n := i * 5
+		placeholders = append(placeholders, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5))
+		args = append(args, tenant, endpoint, version, []byte(r.Payload), r.Reason)
+	}
+	_, err := db.ExecContext(c.Request.Context(),
+		"INSERT INTO traffic_rejected (tenant_id, endpoint, schema_version, payload, reason) VALUES "+strings.Join(placeholders, ", "),
+		args...)
+	if err != nil {
+		requestLog(c).Warn("Failed to store rejected records", "count", len(rejections), "error", err)
+	}
+}
+
+// RejectedTraffic mirrors a row of the traffic_rejected table.
+type RejectedTraffic struct {
+	ID            string          `json:"id"`
+	Endpoint      string          `json:"endpoint"`
+	SchemaVersion int             `json:"schema_version"`
+	Payload       json.RawMessage `json:"payload"`
+	Reason        string          `json:"reason"`
+	CreatedAt     time.Time       `json:"created_at"`
+	ReplayedAt    *time.Time      `json:"replayed_at"`
+}
+
+const rejectedColumns = `id, endpoint, schema_version, payload, reason, created_at, replayed_at`
+
+func scanRejected(s interface{ Scan(...interface{}) error }) (RejectedTraffic, error) {
+	var r RejectedTraffic
+	var payload []byte
+	err := s.Scan(&r.ID, &r.Endpoint, &r.SchemaVersion, &payload, &r.Reason, &r.CreatedAt, &r.ReplayedAt)
+	r.Payload = payload
+	return r, err
+}
+
+// listRejected returns the tenant's most recent rejections, newest first.
+// Replayed ones are left out unless ?include_replayed=true.
+func listRejected(c *gin.Context) {
+	limit := defaultRejectedLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxRejectedLimit {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("invalid limit %q: must be between 1 and %d", v, maxRejectedLimit)})
+			return
+		}
+		limit = n
+	}
+	includeReplayed := c.Query("include_replayed") == "true"
+
+	rows, err := db.QueryContext(c.Request.Context(), `SELECT `+rejectedColumns+` FROM traffic_rejected
+		WHERE tenant_id = $1 AND ($2 OR replayed_at IS NULL)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3`, tenantFromContext(c), includeReplayed, limit)
+	if err != nil {
+		requestLog(c).Error("Failed to query rejected records", "error", err)
+		internalError(c, "failed to fetch rejected records")
+		return
+	}
+	defer rows.Close()
+
+	records := []RejectedTraffic{}
+	for rows.Next() {
+		r, err := scanRejected(rows)
+		if err != nil {
+			requestLog(c).Error("Failed to scan rejected record", "error", err)
+			internalError(c, "failed to fetch rejected records")
+			return
+		}
+		records = append(records, r)
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(c).Error("Failed to iterate rejected records", "error", err)
+		internalError(c, "failed to fetch rejected records")
+		return
+	}
+
+	c.JSON(200, gin.H{"data": records})
+}
+
+// ReplayRejectedRequest is the body of POST /ingest/rejected/replay.
+type ReplayRejectedRequest struct {
+	IDs []string `json:"ids" binding:"required"`
+}
+
+// ReplayFailure reports a rejected record that still doesn't pass.
+type ReplayFailure struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// replayRejected re-submits stored rejections, e.g. after an agent bug or an
+// IP list has been fixed. Records that now pass are inserted and marked
+// replayed; the rest keep their row with the reason updated. Everything
+// happens in one transaction, so a record can't be replayed twice.
+func replayRejected(c *gin.Context) {
+	var req ReplayRejectedRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+		return
+	}
+	if len(req.IDs) == 0 {
+		c.JSON(400, gin.H{"error": "ids must not be empty"})
+		return
+	}
+	if len(req.IDs) > maxReplayIDs {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("too many ids: at most %d per request", maxReplayIDs)})
+		return
+	}
+	for _, id := range req.IDs {
+		if !uuidPattern.MatchString(id) {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("invalid rejected record id %q", id)})
+			return
+		}
+	}
+
+	lists, err := loadIPLists(c)
+	if err != nil {
+		requestLog(c).Error("Failed to load IP lists", "error", err)
+		internalError(c, "failed to replay rejected records")
+		return
+	}
+
+	ctx := c.Request.Context()
+	tenant := tenantFromContext(c)
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		requestLog(c).Error("Failed to begin replay transaction", "error", err)
+		internalError(c, "failed to replay rejected records")
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT `+rejectedColumns+` FROM traffic_rejected
+		WHERE id = ANY($1::uuid[]) AND tenant_id = $2 AND replayed_at IS NULL
+		FOR UPDATE`, pq.Array(req.IDs), tenant)
+	if err != nil {
+		requestLog(c).Error("Failed to load rejected records", "error", err)
+		internalError(c, "failed to replay rejected records")
+		return
+	}
+	var pending []RejectedTraffic
+	for rows.Next() {
+		r, err := scanRejected(rows)
+		if err != nil {
+			rows.Close()
+			requestLog(c).Error("Failed to scan rejected record", "error", err)
+			internalError(c, "failed to replay rejected records")
+			return
+		}
+		pending = append(pending, r)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		requestLog(c).Error("Failed to iterate rejected records", "error", err)
+		internalError(c, "failed to replay rejected records")
+		return
+	}
+
+	var records []TrafficRecord
+	var replayedIDs []string
+	failures := []ReplayFailure{}
+	found := make(map[string]bool, len(pending))
+	for _, r := range pending {
+		found[r.ID] = true
+		record, err := decodeTrafficRecord(r.Payload, r.SchemaVersion)
+		if err == nil {
+			if entry := lists.match(record.SourceIP); entry != nil {
+				if entry.ListType == "deny" {
+					err = fmt.Errorf("source_ip is denylisted: %s", entry.denyReason())
+				} else {
+					record.Label = "benign"
+				}
+			}
+		}
+		if err != nil {
+			reason := err.Error()
+			failures = append(failures, ReplayFailure{ID: r.ID, Error: reason})
+			if _, err := tx.ExecContext(ctx, "UPDATE traffic_rejected SET reason = $1 WHERE id = $2", reason, r.ID); err != nil {
+				requestLog(c).Error("Failed to update rejected record", "id", r.ID, "error", err)
+				internalError(c, "failed to replay rejected records")
+				return
+			}
+			continue
+		}
+		records = append(records, record)
+		replayedIDs = append(replayedIDs, r.ID)
+	}
+
+	if len(records) > 0 {
+		if storeInPostgres {
+			if err := insertTrafficTx(ctx, tx, tenant, records); err != nil {
+				requestLog(c).Error("Failed to insert replayed records", "error", err)
+				internalError(c, "failed to replay rejected records")
+				return
+			}
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE traffic_rejected SET replayed_at = LOCALTIMESTAMP WHERE id = ANY($1::uuid[])", pq.Array(replayedIDs)); err != nil {
+			requestLog(c).Error("Failed to mark rejected records replayed", "error", err)
+			internalError(c, "failed to replay rejected records")
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		requestLog(c).Error("Failed to commit replay", "error", err)
+		internalError(c, "failed to replay rejected records")
+		return
+	}
+	// The records count as replayed once committed; a sink that misses them
+	// is logged rather than failing the replay.
+	if err := forwardTraffic(ctx, tenant, records); err != nil {
+		requestLog(c).Warn("Failed to forward replayed records", "error", err)
+	}
+	ingestRecordsTotal.WithLabelValues("accepted").Add(float64(len(records)))
+
+	// Unknown ids, other tenants' ids and already replayed ones are all
+	// reported as not found.
+	notFound := []string{}
+	for _, id := range req.IDs {
+		if !found[strings.ToLower(id)] {
+			notFound = append(notFound, id)
+		}
+	}
+
+	c.JSON(200, gin.H{"replayed": len(records), "rejected": failures, "not_found": notFound})
+}
+
+// insertTrafficTx inserts records within a transaction owned by the caller.
+func insertTrafficTx(ctx context.Context, tx *sql.Tx, tenant string, records []TrafficRecord) error {
+	stampTraffic(records)
+	query, args := trafficBatchInsert(tenant, records)
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Sampling lets the service store only a fraction of ordinary traffic under
+// extreme load. A record that looks threatening is always kept; the rest are
+// kept with probability ingestSampleRate. Stored rows carry the rate they were
+// kept at in traffic.sample_rate (1 when not subject to sampling), so counts
+// can be extrapolated as SUM(1 / sample_rate).
+var (
+	// ingestSampleRate is INGEST_SAMPLE_RATE; 1 disables sampling.
+	ingestSampleRate = 1.0
+
+	// sampleKeepScore is INGEST_SAMPLE_KEEP_SCORE: records whose
+	// preliminary threat score reaches it bypass sampling.
+	sampleKeepScore = 0.4
+
+	// Thresholds of the built-in scoring rules, read from the same variables
+	// as the api-gateway's.
+	sampleDoSPacketRate      = 1000.0
+	sampleLargeTransferBytes = int64(10 * 1024 * 1024)
+)
+
+// Ports commonly targeted by remote-access attacks, as in the gateway's
+// built-in rules.
+var sensitivePorts = map[int]bool{21: true, 22: true, 23: true, 445: true, 3389: true}
+
+// preliminaryScore approximates the gateway's built-in scoring rules. It only
+// decides whether a record is worth keeping regardless of sampling; the stored
+// verdict still comes from /analyze.
+func preliminaryScore(r TrafficRecord) float64 {
+	score := 0.0
+	if float64(*r.PacketCount)/math.Max(durationOf(r), 1) >= sampleDoSPacketRate {
+		score += 0.6
+	}
+	if *r.PacketCount <= 3 && *r.Bytes < 100 {
+		score += 0.4
+	}
+	if sensitivePorts[*r.DestPort] {
+		score += 0.3
+	}
+	if *r.Bytes >= sampleLargeTransferBytes {
+		score += 0.3
+	}
+	return math.Min(score, 1)
+}
+
+// sampleIn decides whether to store r, setting r.SampleRate to the rate it
+// was kept at. It reports false for records dropped by sampling.
+func sampleIn(r *TrafficRecord) bool {
+	r.SampleRate = 1
+	if ingestSampleRate >= 1 || preliminaryScore(*r) >= sampleKeepScore {
+		return true
+	}
+	if rand.Float64() >= ingestSampleRate {
+		return false
+	}
+	r.SampleRate = ingestSampleRate
+	return true
+}
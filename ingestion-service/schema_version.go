@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// defaultSchemaVersion applies to payloads that name no version, which is
+// every agent written before versioning was introduced.
+const defaultSchemaVersion = 1
+
+// trafficDecoders turns a raw payload of each supported schema version into a
+// validated TrafficRecord. A new payload format gets a new entry here.
+var trafficDecoders = map[int]func(raw json.RawMessage) (TrafficRecord, error){
+	1: decodeTrafficV1,
+}
+
+func decodeTrafficV1(raw json.RawMessage) (TrafficRecord, error) {
+	var record TrafficRecord
+	if err := decodeJSON(raw, &record); err != nil {
+		return record, describeRecordError(err)
+	}
+	return record, describeRecordError(binding.Validator.ValidateStruct(&record))
+}
+
+// decodeJSON unmarshals raw with UseNumber, so numbers decoded into an
+// untyped value keep every digit instead of becoming float64 and losing
+// precision above 2^53. Counters in typed fields are int64 and exact anyway.
+func decodeJSON(raw []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// schemaVersionHeader reads X-Schema-Version, the default version for records
+// that don't carry their own schema_version.
+func schemaVersionHeader(c *gin.Context) (int, error) {
+	v := c.GetHeader("X-Schema-Version")
+	if v == "" {
+		return defaultSchemaVersion, nil
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid X-Schema-Version %q: must be a positive integer", v)
+	}
+	return version, nil
+}
+
+// decodeTrafficRecord dispatches raw to the decoder for its schema_version
+// (falling back to defaultVersion), then normalizes the record's addresses.
+func decodeTrafficRecord(raw json.RawMessage, defaultVersion int) (TrafficRecord, error) {
+	var probe struct {
+		SchemaVersion *int `json:"schema_version"`
+	}
+	if err := decodeJSON(raw, &probe); err != nil {
+		return TrafficRecord{}, err
+	}
+	version := defaultVersion
+	if probe.SchemaVersion != nil {
+		version = *probe.SchemaVersion
+	}
+
+	decode, ok := trafficDecoders[version]
+	if !ok {
+		return TrafficRecord{}, fmt.Errorf("unsupported schema_version %d: supported versions are %s", version, supportedSchemaVersions())
+	}
+	record, err := decode(raw)
+	if err != nil {
+		return record, err
+	}
+	record.SchemaVersion = version
+	return record, record.normalizeIPs()
+}
+
+func supportedSchemaVersions() string {
+	versions := make([]int, 0, len(trafficDecoders))
+	for v := range trafficDecoders {
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+	names := make([]string, len(versions))
+	for i, v := range versions {
+		names[i] = strconv.Itoa(v)
+	}
+	return strings.Join(names, ", ")
+}
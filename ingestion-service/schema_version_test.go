@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/yourusername/threat-detector/ingestion-service/ingestpb"
+)
+
+// Above 2^53, where a float64 can no longer hold every integer.
+const (
+	bigBytes   int64 = 1<<53 + 1 // 9007199254740993
+	bigPackets int64 = 1<<62 + 7
+)
+
+func checkBigCounters(t *testing.T, record TrafficRecord) {
+	t.Helper()
+	if record.Bytes == nil || *record.Bytes != bigBytes {
+		t.Errorf("bytes = %v, want %d", record.Bytes, bigBytes)
+	}
+	if record.PacketCount == nil || *record.PacketCount != bigPackets {
+		t.Errorf("packet_count = %v, want %d", record.PacketCount, bigPackets)
+	}
+}
+
+func TestDecodeTrafficRecordKeepsCountersAbove2To53(t *testing.T) {
+	raw := json.RawMessage(`{"source_ip": "10.0.0.1", "dest_port": 443, "protocol": "tcp",
+		"bytes": 9007199254740993, "packet_count": 4611686018427387911}`)
+	record, err := decodeTrafficRecord(raw, defaultSchemaVersion)
+	if err != nil {
+		t.Fatalf("decodeTrafficRecord: %v", err)
+	}
+	checkBigCounters(t, record)
+
+	// Async ingest stores the record as JSON in Redis and decodes it again.
+	payload, err := json.Marshal(asyncJob{TenantID: "default", Record: record})
+	if err != nil {
+		t.Fatalf("marshal queued record: %v", err)
+	}
+	var job asyncJob
+	if err := decodeJSON(payload, &job); err != nil {
+		t.Fatalf("decode queued record: %v", err)
+	}
+	checkBigCounters(t, job.Record)
+}
+
+func TestDecodeProtobufTrafficRecordKeepsCountersAbove2To53(t *testing.T) {
+	port := uint32(443)
+	bytes, packets := bigBytes, bigPackets
+	m := &ingestpb.TrafficRecord{SourceIp: "10.0.0.1", DestPort: &port, Protocol: "tcp", Bytes: &bytes, PacketCount: &packets}
+	record, err := decodeTrafficRecord(trafficRecordJSON(m), defaultSchemaVersion)
+	if err != nil {
+		t.Fatalf("decodeTrafficRecord: %v", err)
+	}
+	checkBigCounters(t, record)
+}
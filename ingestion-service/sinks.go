@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Sink is a destination for ingested traffic. Write receives records that
+// are validated and stamped (see stampTraffic), all of one tenant, and must
+// not modify them: sinks run concurrently on the same slice.
+type Sink interface {
+	Write(ctx context.Context, tenant string, records []TrafficRecord) error
+}
+
+// namedSink is a configured sink with the name it was selected by, used in
+// errors and the ingest_sink_errors_total metric.
+type namedSink struct {
+	name string
+	Sink
+}
+
+// trafficSinks are the sinks selected by INGEST_SINKS, Postgres by default.
+// storeInPostgres says whether the postgres sink is among them, for the paths
+// that insert into Postgres inside their own transaction.
+var (
+	trafficSinks    = []namedSink{{"postgres", postgresSink{}}}
+	storeInPostgres = true
+)
+
+var sinkErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "ingest_sink_errors_total",
+	Help: "Failed writes of traffic batches, by sink.",
+}, []string{"sink"})
+
+// initSinks reads INGEST_SINKS, a comma-separated list of postgres and file.
+// The file sink appends JSON lines to INGEST_SINK_FILE_PATH.
+func initSinks() error {
+	var sinks []namedSink
+	seen := map[string]bool{}
+	for _, name := range strings.Split(getEnv("INGEST_SINKS", "postgres"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		switch name {
+		case "postgres":
+			sinks = append(sinks, namedSink{name, postgresSink{}})
+		case "file":
+			sink, err := newFileSink(getEnv("INGEST_SINK_FILE_PATH", "traffic.jsonl"))
+			if err != nil {
+				return err
+			}
+			sinks = append(sinks, namedSink{name, sink})
+		default:
+			return fmt.Errorf("unknown sink %q in INGEST_SINKS: must be postgres or file", name)
+		}
+	}
+	if len(sinks) == 0 {
+		return errors.New("INGEST_SINKS names no sink")
+	}
+	trafficSinks, storeInPostgres = sinks, seen["postgres"]
+	return nil
+}
+
+// closeSinks releases the sinks' resources on shutdown.
+func closeSinks() {
+	for _, s := range trafficSinks {
+		if closer, ok := s.Sink.(interface{ Close() error }); ok {
+			if err := closer.Close(); err != nil {
+				slog.Warn("Failed to close sink", "sink", s.name, "error", err)
+			}
+		}
+	}
+}
+
+// stampTraffic gives records without one an id and received_at, so every
+// sink stores a record under the same identity.
+func stampTraffic(records []TrafficRecord) {
+	// Postgres keeps microseconds; stamping at that precision means the time
+	// returned to the agent is exactly the one stored.
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	for i := range records {
+		if records[i].ID == "" {
+			records[i].ID = uuid.NewString()
+		}
+		if records[i].ReceivedAt.IsZero() {
+			records[i].ReceivedAt = now
+		}
+	}
+}
+
+// writeTraffic writes records to every configured sink at once. It fails if
+// any sink does; the others may have stored the records regardless, so a
+// retry can store them twice there.
+func writeTraffic(ctx context.Context, tenant string, records []TrafficRecord) error {
+	stampTraffic(records)
+	return fanOutTraffic(ctx, tenant, records, trafficSinks)
+}
+
+// forwardTraffic writes records that were already inserted into Postgres, in
+// the caller's transaction, to the other sinks.
+func forwardTraffic(ctx context.Context, tenant string, records []TrafficRecord) error {
+	if storeInPostgres && len(records) > 0 {
+		invalidateStats(ctx, tenant)
+	}
+	var others []namedSink
+	for _, s := range trafficSinks {
+		if s.name != "postgres" {
+			others = append(others, s)
+		}
+	}
+	stampTraffic(records)
+	return fanOutTraffic(ctx, tenant, records, others)
+}
+
+func fanOutTraffic(ctx context.Context, tenant string, records []TrafficRecord, sinks []namedSink) error {
+	if len(records) == 0 || len(sinks) == 0 {
+		return nil
+	}
+	errs := make([]error, len(sinks))
+	var wg sync.WaitGroup
+	for i, s := range sinks {
+		wg.Add(1)
+		go func(i int, s namedSink) {
+			defer wg.Done()
+			if err := s.Write(ctx, tenant, records); err != nil {
+				sinkErrorsTotal.WithLabelValues(s.name).Inc()
+				errs[i] = fmt.Errorf("%s sink: %w", s.name, err)
+			}
+		}(i, s)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// postgresSink inserts records into the traffic table, the behavior before
+// sinks were configurable.
+type postgresSink struct{}
+
+func (postgresSink) Write(ctx context.Context, tenant string, records []TrafficRecord) error {
+	if err := insertTrafficBatch(ctx, tenant, records); err != nil {
+		return err
+	}
+	invalidateStats(ctx, tenant)
+	return nil
+}
+
+// fileSink appends one JSON object per record to a local file. The file is
+// opened in append mode, so it can be rotated by moving it away and
+// restarting, or truncated in place.
+type fileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newFileSink(path string) (*fileSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open file sink: %w", err)
+	}
+	return &fileSink{file: f}, nil
+}
+
+// fileSinkRecord is a line of the file sink: the record's JSON fields plus
+// what the service adds to it.
+type fileSinkRecord struct {
+	ID         string    `json:"id"`
+	TenantID   string    `json:"tenant_id"`
+	ReceivedAt time.Time `json:"received_at"`
+	TrafficRecord
+	Label          string  `json:"label,omitempty"`
+	SampleRate     float64 `json:"sample_rate"`
+	SyslogSeverity *int    `json:"syslog_severity,omitempty"`
+	Message        string  `json:"message,omitempty"`
+}
+
+// Write writes the batch with a single call, so concurrent batches never
+// interleave their lines.
+func (s *fileSink) Write(ctx context.Context, tenant string, records []TrafficRecord) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range records {
+		sampleRate := r.SampleRate
+		if sampleRate == 0 {
+			sampleRate = 1
+		}
+		line := fileSinkRecord{
+			ID: r.ID, TenantID: tenant, ReceivedAt: r.ReceivedAt, TrafficRecord: r,
+			Label: r.Label, SampleRate: sampleRate, SyslogSeverity: r.SyslogSeverity, Message: r.Message,
+		}
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.file.Write(buf.Bytes())
+	return err
+}
+
+func (s *fileSink) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Stats cache invalidation, toggled by STATS_CACHE_INVALIDATION: once traffic
+// is stored, the tenant is published on statsInvalidationChannel and the API
+// gateway deletes its cached stats, so dashboards don't wait out the cache
+// TTL. It is off by default because each invalidation sends the next stats
+// requests to the database.
+var (
+	statsInvalidation        = false
+	statsInvalidationChannel = "stats:invalidate"
+	// statsInvalidationInterval is the least time between two messages for
+	// the same tenant, so a busy agent doesn't empty the cache on every
+	// request. Set by STATS_INVALIDATION_INTERVAL.
+	statsInvalidationInterval = 5 * time.Second
+	statsInvalidations        = &invalidationThrottle{tenants: map[string]*tenantThrottle{}}
+)
+
+// invalidateStats publishes tenant on statsInvalidationChannel, at most once
+// per statsInvalidationInterval. A call inside the interval schedules one
+// publish for its end instead, so stats cached meanwhile don't outlive the
+// last write. Failures are only logged; the cached stats still expire on
+// their TTL.
+func invalidateStats(ctx context.Context, tenant string) {
+	if !statsInvalidation {
+		return
+	}
+	delay, ok := statsInvalidations.claim(tenant, time.Now())
+	if !ok {
+		return
+	}
+	if delay > 0 {
+		time.AfterFunc(delay, func() {
+			statsInvalidations.done(tenant)
+			publishStatsInvalidation(context.Background(), tenant)
+		})
+		return
+	}
+	publishStatsInvalidation(ctx, tenant)
+}
+
+func publishStatsInvalidation(ctx context.Context, tenant string) {
+	if err := redisClient.Publish(ctx, statsInvalidationChannel, tenant).Err(); err != nil {
+		slog.Warn("Failed to publish stats invalidation", "tenant_id", tenant, "error", err)
+	}
+}
+
+// invalidationThrottle tracks, per tenant, when the last invalidation was or
+// is scheduled to be published.
+type invalidationThrottle struct {
+	mu      sync.Mutex
+	tenants map[string]*tenantThrottle
+}
+
+type tenantThrottle struct {
+	last    time.Time // time of the last publish, or of the scheduled one
+	pending bool      // a publish is scheduled for last
+}
+
+// claim decides how an invalidation of tenant at now is published: right
+// away (0, true), after a delay that ends the current interval (delay, true),
+// or not at all because one is already scheduled (0, false). A scheduled
+// publish must call done when it runs.
+func (t *invalidationThrottle) claim(tenant string, now time.Time) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st, ok := t.tenants[tenant]
+	if !ok {
+		st = &tenantThrottle{}
+		t.tenants[tenant] = st
+	}
+	if st.pending {
+		return 0, false
+	}
+	if now.Sub(st.last) >= statsInvalidationInterval {
+		st.last = now
+		return 0, true
+	}
+	st.last, st.pending = st.last.Add(statsInvalidationInterval), true
+	return st.last.Sub(now), true
+}
+
+// done marks tenant's scheduled publish as sent.
+func (t *invalidationThrottle) done(tenant string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if st, ok := t.tenants[tenant]; ok {
+		st.pending = false
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamCommitEvery is how many records /ingest/stream inserts per
+// transaction. Earlier chunks stay committed if a later one fails.
+const streamCommitEvery = 500
+
+// ingestStreamTraffic accepts newline-delimited JSON records and inserts them
+// in chunks as they are decoded, so the body is never held in memory as a
+// whole. Invalid or denylisted records are reported by index at the end and
+// kept in the dead-letter store; a malformed line stops the stream, keeping
+// everything committed before it.
+func ingestStreamTraffic(c *gin.Context) {
+	version, err := schemaVersionHeader(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	lists, err := loadIPLists(c)
+	if err != nil {
+		requestLog(c).Error("Failed to load IP lists", "error", err)
+		internalError(c, "failed to store traffic stream")
+		return
+	}
+
+	ctx := c.Request.Context()
+	tenant := tenantFromContext(c)
+	accepted, sampledOut := 0, 0
+	rejected := []RejectedRecord{}
+	var dead []rejection
+	pending := make([]TrafficRecord, 0, streamCommitEvery)
+
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		if err := writeTraffic(ctx, tenant, pending); err != nil {
+			return err
+		}
+		ingestRecordsTotal.WithLabelValues("accepted").Add(float64(len(pending)))
+		accepted += len(pending)
+		pending = pending[:0]
+		return nil
+	}
+
+	dec := json.NewDecoder(c.Request.Body)
+	dec.UseNumber()
+	for i := 0; ; i++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			msg := "malformed JSON, stream stopped: " + err.Error()
+			if isBodyTooLarge(err) {
+				msg = "request body too large, stream stopped"
+			}
+			rejected = append(rejected, RejectedRecord{Index: i, Error: msg})
+			break
+		}
+
+		record, err := decodeTrafficRecord(raw, version)
+		if err != nil {
+			rejected = append(rejected, RejectedRecord{Index: i, Error: err.Error()})
+			dead = append(dead, rejection{Payload: raw, Reason: err.Error()})
+			continue
+		}
+		if entry := lists.match(record.SourceIP); entry != nil {
+			if entry.ListType == "deny" {
+				reason := "source_ip is denylisted: " + entry.denyReason()
+				rejected = append(rejected, RejectedRecord{Index: i, Error: reason})
+				dead = append(dead, rejection{Payload: raw, Reason: reason})
+				continue
+			}
+			record.Label = "benign"
+		}
+
+		if !sampleIn(&record) {
+			sampledOut++
+			continue
+		}
+		pending = append(pending, record)
+		if len(pending) == streamCommitEvery {
+			if err := flush(); err != nil {
+				streamInsertFailed(c, err, accepted, rejected)
+				return
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		streamInsertFailed(c, err, accepted, rejected)
+		return
+	}
+
+	ingestRecordsTotal.WithLabelValues("rejected").Add(float64(len(rejected)))
+	ingestRecordsTotal.WithLabelValues("sampled_out").Add(float64(sampledOut))
+	storeRejected(c, "stream", version, dead)
+
+	if accepted == 0 && sampledOut == 0 {
+		c.JSON(400, gin.H{"error": "no valid records in stream", "accepted": 0, "rejected": rejected})
+		return
+	}
+	c.JSON(201, gin.H{"accepted": accepted, "sampled_out": sampledOut, "rejected": rejected})
+}
+
+// streamInsertFailed reports a failed chunk insert along with how many
+// records were already committed, so the agent knows where to resume.
+func streamInsertFailed(c *gin.Context, err error, accepted int, rejected []RejectedRecord) {
+	requestLog(c).Error("Failed to insert traffic stream chunk", "accepted", accepted, "error", err)
+	ingestRecordsTotal.WithLabelValues("rejected").Add(float64(len(rejected)))
+	internalError(c, fmt.Sprintf("failed to store traffic stream after %d records", accepted))
+}
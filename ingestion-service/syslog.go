@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+const (
+	// maxSyslogLineBytes bounds a single line of /ingest/syslog.
+	maxSyslogLineBytes = 64 << 10
+
+	// maxSyslogMessageLen bounds the message text stored with a record.
+	maxSyslogMessageLen = 1024
+
+	// defaultSyslogSeverity is used for lines without a PRI, which RFC 3164
+	// treats as user.notice.
+	defaultSyslogSeverity = 5
+)
+
+// syslogMessage is what parseSyslog takes from one line.
+type syslogMessage struct {
+	Severity int
+	Hostname string
+	Message  string
+
+	// Fields holds key=value pairs from structured data and the message
+	// text, keyed in lower case. The first occurrence of a key wins.
+	Fields map[string]string
+}
+
+// syslogKeyValue matches key=value pairs in a message, with the value either
+// bare or double-quoted.
+var syslogKeyValue = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_.-]*)=("(?:[^"\\]|\\.)*"|[^\s,;]*)`)
+
+// parseSyslog parses an RFC 5424 line, falling back to the looser RFC 3164
+// format: an optional PRI, an optional "Mmm dd hh:mm:ss" timestamp and
+// hostname, then the message.
+func parseSyslog(line string) (syslogMessage, error) {
+	m := syslogMessage{Severity: defaultSyslogSeverity, Fields: map[string]string{}}
+	rest := line
+	if strings.HasPrefix(rest, "<") {
+		end := strings.IndexByte(rest, '>')
+		if end < 2 || end > 4 {
+			return m, errors.New("malformed PRI")
+		}
+		pri, err := strconv.Atoi(rest[1:end])
+		if err != nil || pri < 0 || pri > 191 {
+			return m, fmt.Errorf("invalid PRI %q", rest[1:end])
+		}
+		m.Severity = pri % 8
+		rest = rest[end+1:]
+	}
+
+	if strings.HasPrefix(rest, "1 ") {
+		if err := m.parseRFC5424(rest[2:]); err != nil {
+			return m, err
+		}
+	} else {
+		m.parseRFC3164(rest)
+	}
+
+	for _, kv := range syslogKeyValue.FindAllStringSubmatch(m.Message, -1) {
+		m.setField(kv[1], unquoteSyslogValue(kv[2]))
+	}
+	return m, nil
+}
+
+// parseRFC5424 reads "TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD [MSG]",
+// the header after the version.
+func (m *syslogMessage) parseRFC5424(s string) error {
+	header := strings.SplitN(s, " ", 6)
+	if len(header) < 6 {
+		return errors.New("truncated RFC 5424 header")
+	}
+	if header[0] != "-" {
+		if _, err := time.Parse(time.RFC3339Nano, header[0]); err != nil {
+			return fmt.Errorf("invalid RFC 5424 timestamp %q", header[0])
+		}
+	}
+	if header[1] != "-" {
+		m.Hostname = header[1]
+	}
+
+	rest := header[5]
+	if after, ok := strings.CutPrefix(rest, "-"); ok {
+		rest = after
+	} else {
+		var err error
+		if rest, err = m.parseStructuredData(rest); err != nil {
+			return err
+		}
+	}
+	if rest != "" && rest[0] != ' ' {
+		return errors.New("missing space after structured data")
+	}
+	m.Message = strings.TrimPrefix(strings.TrimPrefix(rest, " "), "\ufeff")
+	return nil
+}
+
+// parseStructuredData consumes the SD-ELEMENTs at the start of s, recording
+// their parameters as fields, and returns what follows them.
+func (m *syslogMessage) parseStructuredData(s string) (string, error) {
+	for strings.HasPrefix(s, "[") {
+		i := 1
+		for i < len(s) && s[i] != ' ' && s[i] != ']' {
+			i++
+		}
+		for i < len(s) && s[i] == ' ' {
+			// PARAM-NAME="PARAM-VALUE", where \" \\ and \] are escaped
+			eq := strings.IndexByte(s[i:], '=')
+			if eq < 0 || i+eq+1 >= len(s) || s[i+eq+1] != '"' {
+				return "", errors.New("malformed structured data")
+			}
+			name := strings.TrimSpace(s[i : i+eq])
+			var value strings.Builder
+			j := i + eq + 2
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				value.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return "", errors.New("unterminated structured data value")
+			}
+			m.setField(name, value.String())
+			i = j + 1
+		}
+		if i >= len(s) || s[i] != ']' {
+			return "", errors.New("unterminated structured data element")
+		}
+		s = s[i+1:]
+	}
+	return s, nil
+}
+
+// parseRFC3164 never fails: whatever doesn't look like a timestamp and a
+// hostname is taken as the message.
+func (m *syslogMessage) parseRFC3164(s string) {
+	if len(s) > len(time.Stamp) && s[len(time.Stamp)] == ' ' {
+		if _, err := time.Parse(time.Stamp, s[:len(time.Stamp)]); err == nil {
+			s = s[len(time.Stamp)+1:]
+			// The hostname is absent when the line goes straight to a
+			// "tag:" or "tag[pid]:".
+			if host, msg, ok := strings.Cut(s, " "); ok && !strings.ContainsAny(host, ":[") {
+				m.Hostname, s = host, msg
+			}
+		}
+	}
+	m.Message = strings.TrimSpace(s)
+}
+
+func (m *syslogMessage) setField(key, value string) {
+	key = strings.ToLower(key)
+	if _, ok := m.Fields[key]; !ok {
+		m.Fields[key] = value
+	}
+}
+
+func unquoteSyslogValue(v string) string {
+	if len(v) >= 2 && v[0] == '"' {
+		if s, err := strconv.Unquote(v); err == nil {
+			return s
+		}
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+// field returns the first of keys present in the message.
+func (m syslogMessage) field(keys ...string) (string, bool) {
+	for _, k := range keys {
+		if v, ok := m.Fields[k]; ok && v != "" {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// syslogProtocols maps IANA protocol numbers to the names traffic records use.
+var syslogProtocols = map[string]string{"1": "icmp", "6": "tcp", "17": "udp"}
+
+// trafficRecord builds a traffic record from the message's fields, using the
+// key names common to firewall logs (iptables SRC=/DST=/PROTO=, and the like).
+// Without a source address field the hostname is used if it is an IP, and a
+// message without a protocol is not a flow and is rejected.
+func (m syslogMessage) trafficRecord() (TrafficRecord, error) {
+	record := TrafficRecord{SchemaVersion: defaultSchemaVersion}
+
+	if v, ok := m.field("src", "src_ip", "srcip", "source_ip"); ok {
+		record.SourceIP = v
+	} else if net.ParseIP(m.Hostname) != nil {
+		record.SourceIP = m.Hostname
+	} else {
+		return record, errors.New("no source IP: expected src= in the message or an IP address as hostname")
+	}
+	record.DestIP, _ = m.field("dst", "dst_ip", "dstip", "dest_ip")
+
+	proto, ok := m.field("proto", "protocol")
+	if !ok {
+		return record, errors.New("no protocol: expected proto= in the message")
+	}
+	proto = strings.ToLower(proto)
+	if name, ok := syslogProtocols[proto]; ok {
+		proto = name
+	}
+	record.Protocol = proto
+
+	var err error
+	if record.SourcePort, err = m.intField("source port", "spt", "sport", "src_port", "srcport", "source_port"); err != nil {
+		return record, err
+	}
+	if record.DestPort, err = m.intField("destination port", "dpt", "dport", "dst_port", "dstport", "dest_port"); err != nil {
+		return record, err
+	}
+	if record.DestPort == nil {
+		zero := 0
+		record.DestPort = &zero
+	}
+	if record.Bytes, err = m.int64Field("bytes", 0, "bytes", "len", "length"); err != nil {
+		return record, err
+	}
+	if record.PacketCount, err = m.int64Field("packet count", 1, "packets", "pkts", "packet_count"); err != nil {
+		return record, err
+	}
+
+	if err := binding.Validator.ValidateStruct(&record); err != nil {
+		return record, describeRecordError(err)
+	}
+	if err := record.normalizeIPs(); err != nil {
+		return record, err
+	}
+	severity := m.Severity
+	record.SyslogSeverity = &severity
+	record.Message = truncateUTF8(m.Message, maxSyslogMessageLen)
+	return record, nil
+}
+
+func (m syslogMessage) intField(what string, keys ...string) (*int, error) {
+	v, ok := m.field(keys...)
+	if !ok {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q", what, v)
+	}
+	return &n, nil
+}
+
+func (m syslogMessage) int64Field(what string, fallback int64, keys ...string) (*int64, error) {
+	v, ok := m.field(keys...)
+	if !ok {
+		return &fallback, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q", what, v)
+	}
+	return &n, nil
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// ingestSyslogTraffic accepts syslog messages, one per line, and stores each
+// as a traffic record along with its severity and message text. Blank lines
+// are skipped. Lines that can't be parsed into a flow, and denylisted ones,
+// are reported by line index; unlike JSON records they aren't kept in the
+// dead-letter store, since replay only understands JSON.
+func ingestSyslogTraffic(c *gin.Context) {
+	type line struct {
+		index int
+		text  string
+	}
+	var lines []line
+	scanner := bufio.NewScanner(c.Request.Body)
+	scanner.Buffer(make([]byte, 0, 4096), maxSyslogLineBytes)
+	for i := 0; scanner.Scan(); i++ {
+		// Postgres rejects NUL and invalid UTF-8 in text columns
+		text := strings.ToValidUTF8(strings.ReplaceAll(scanner.Text(), "\x00", ""), "\uFFFD")
+		if text = strings.TrimSpace(text); text != "" {
+			lines = append(lines, line{index: i, text: text})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		switch {
+		case isBodyTooLarge(err):
+			c.JSON(413, gin.H{"error": "request body too large"})
+		case errors.Is(err, bufio.ErrTooLong):
+			c.JSON(400, gin.H{"error": fmt.Sprintf("line %d exceeds the maximum of %d bytes", len(lines)+1, maxSyslogLineBytes)})
+		default:
+			c.JSON(400, gin.H{"error": "failed to read request body: " + err.Error()})
+		}
+		return
+	}
+	if len(lines) == 0 {
+		c.JSON(400, gin.H{"error": "no syslog messages in request"})
+		return
+	}
+	if len(lines) > maxBatchSize {
+		c.JSON(413, gin.H{"error": fmt.Sprintf("%d syslog messages exceed the maximum of %d", len(lines), maxBatchSize)})
+		return
+	}
+
+	lists, err := loadIPLists(c)
+	if err != nil {
+		requestLog(c).Error("Failed to load IP lists", "error", err)
+		internalError(c, "failed to store syslog messages")
+		return
+	}
+
+	records := make([]TrafficRecord, 0, len(lines))
+	indexes := make([]int, 0, len(lines)) // line number of each record
+	rejected := []RejectedRecord{}
+	unparseable, sampledOut := 0, 0
+	for _, l := range lines {
+		msg, err := parseSyslog(l.text)
+		var record TrafficRecord
+		if err == nil {
+			record, err = msg.trafficRecord()
+		}
+		if err != nil {
+			unparseable++
+			rejected = append(rejected, RejectedRecord{Index: l.index, Error: err.Error()})
+			continue
+		}
+		if entry := lists.match(record.SourceIP); entry != nil {
+			if entry.ListType == "deny" {
+				rejected = append(rejected, RejectedRecord{Index: l.index, Error: "source_ip is denylisted: " + entry.denyReason()})
+				continue
+			}
+			record.Label = "benign"
+		}
+		if !sampleIn(&record) {
+			sampledOut++
+			continue
+		}
+		records = append(records, record)
+		indexes = append(indexes, l.index)
+	}
+
+	ingestRecordsTotal.WithLabelValues("rejected").Add(float64(len(rejected)))
+	ingestRecordsTotal.WithLabelValues("sampled_out").Add(float64(sampledOut))
+
+	if len(records) == 0 && sampledOut == 0 {
+		c.JSON(400, gin.H{"error": "no valid syslog messages", "accepted": 0, "rejected": rejected, "unparseable": unparseable})
+		return
+	}
+
+	chunks := insertTrafficChunks(c.Request.Context(), tenantFromContext(c), records)
+	failedChunks, failed := 0, 0
+	for n, chunk := range chunks {
+		if chunk.err == nil {
+			continue
+		}
+		failedChunks++
+		failed += chunk.end - chunk.start
+		requestLog(c).Error("Failed to insert syslog chunk", "chunk", n, "records", chunk.end-chunk.start, "error", chunk.err)
+		for _, i := range indexes[chunk.start:chunk.end] {
+			rejected = append(rejected, RejectedRecord{Index: i, Error: fmt.Sprintf("not stored: chunk %d of the batch failed to insert", n)})
+		}
+	}
+	if failedChunks > 0 && failedChunks == len(chunks) {
+		internalError(c, "failed to store syslog messages")
+		return
+	}
+
+	ingestRecordsTotal.WithLabelValues("accepted").Add(float64(len(records) - failed))
+	ingestRecordsTotal.WithLabelValues("failed").Add(float64(failed))
+	c.JSON(201, gin.H{
+		"accepted":      len(records) - failed,
+		"sampled_out":   sampledOut,
+		"rejected":      rejected,
+		"unparseable":   unparseable,
+		"failed_chunks": failedChunks,
+	})
+}
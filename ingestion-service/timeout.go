@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sony/gobreaker"
+)
+
+// timeoutMiddleware bounds the request context by d. Handlers pass that
+// context to the database, so a slow query is canceled at the deadline
+// instead of holding the connection and the worker indefinitely.
+func timeoutMiddleware(d time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// newHTTPServer returns a server for handler on addr with connection
+// timeouts from the environment, so a client can't hold a connection open by
+// sending its request or reading the response slowly. HTTP_WRITE_TIMEOUT must
+// exceed the request timeouts, or handlers are cut off before they give up.
+func newHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: getEnvDuration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+		ReadTimeout:       getEnvDuration("HTTP_READ_TIMEOUT", 30*time.Second),
+		WriteTimeout:      getEnvDuration("HTTP_WRITE_TIMEOUT", 60*time.Second),
+		IdleTimeout:       getEnvDuration("HTTP_IDLE_TIMEOUT", 120*time.Second),
+	}
+}
+
+// connDeadline moves the connection's read and write deadlines, set by the
+// server from HTTP_READ_TIMEOUT and HTTP_WRITE_TIMEOUT, to d from now for
+// routes that legitimately run longer. A d of 0 removes them.
+func connDeadline(d time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var deadline time.Time
+		if d > 0 {
+			deadline = time.Now().Add(d)
+		}
+		rc := http.NewResponseController(c.Writer)
+		if err := errors.Join(rc.SetReadDeadline(deadline), rc.SetWriteDeadline(deadline)); err != nil {
+			requestLog(c).Warn("Failed to extend connection deadline", "error", err)
+		}
+		c.Next()
+	}
+}
+
+// internalError responds with a 500 carrying message, with a 504 when the
+// failure was caused by the request's deadline expiring, or with a 503 while
+// the database circuit breaker isn't closed.
+func internalError(c *gin.Context, message string) {
+	if dbBreaker != nil && dbBreaker.State() != gobreaker.StateClosed {
+		dbUnavailable(c)
+		return
+	}
+	if errors.Is(c.Request.Context().Err(), context.DeadlineExceeded) {
+		c.JSON(504, gin.H{"error": "request timed out"})
+		return
+	}
+	c.JSON(500, gin.H{"error": message})
+}
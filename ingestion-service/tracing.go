@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// tracingEnabled reports whether the standard OTEL_* variables ask for traces
+// to be exported: an OTLP endpoint is set and neither OTEL_SDK_DISABLED nor
+// OTEL_TRACES_EXPORTER=none turns them off.
+func tracingEnabled() bool {
+	if getEnvBool("OTEL_SDK_DISABLED", false) || strings.EqualFold(os.Getenv("OTEL_TRACES_EXPORTER"), "none") {
+		return false
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// initTracing sets up OpenTelemetry tracing and returns a function that
+// flushes pending spans on shutdown. W3C traceparent/tracestate (and baggage)
+// are always propagated, so incoming trace context is carried through even
+// when nothing is exported. Only when tracingEnabled is a tracer provider
+// installed, batching spans to the OTLP/HTTP exporter, which reads its
+// endpoint, headers and timeout from the OTEL_EXPORTER_OTLP_* variables;
+// otherwise every span is a no-op. OTEL_SERVICE_NAME and
+// OTEL_RESOURCE_ATTRIBUTES override the resource.
+func initTracing(ctx context.Context, service string) func(context.Context) error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if !tracingEnabled() {
+		return func(context.Context) error { return nil }
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		log.Fatal("Failed to create OTLP trace exporter:", err)
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(service)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		log.Printf("Incomplete tracing resource: %v", err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+
+	log.Println("Tracing enabled, exporting spans over OTLP")
+	return provider.Shutdown
+}
+
+// tracingMiddleware starts a server span per request, continuing the trace of
+// an incoming traceparent header. Health checks and scrapes aren't traced.
+func tracingMiddleware(service string) gin.HandlerFunc {
+	return otelgin.Middleware(service, otelgin.WithFilter(func(r *http.Request) bool {
+		return !quietRoutes[r.URL.Path]
+	}))
+}
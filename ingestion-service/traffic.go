@@ -0,0 +1,415 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBatchSize caps the number of records accepted by /ingest/batch.
+var maxBatchSize = 1000
+
+// A batch is inserted batchChunkSize records per INSERT and transaction,
+// batchChunkConcurrency chunks at a time, so a large batch never becomes one
+// long-running transaction. Set by INGEST_BATCH_CHUNK_SIZE and
+// INGEST_BATCH_CHUNK_CONCURRENCY.
+var (
+	batchChunkSize        = 500
+	batchChunkConcurrency = 1
+)
+
+// maxBatchChunkSize keeps a chunk's INSERT within Postgres's limit of 65535
+// bind parameters.
+const maxBatchChunkSize = 65535 / trafficArgsPerRow
+
+// trafficInsertColumns is the column list shared by single and batch inserts.
+const trafficInsertColumns = "id, tenant_id, source_ip, dest_ip, source_port, dest_port, protocol, bytes, packet_count, duration, label, schema_version, country, city, asn, as_org, sample_rate, syslog_severity, message, received_at"
+
+// TrafficRecord is a single flow record submitted by an agent. Counters are
+// pointers so that `required` rejects a missing field while still accepting
+// an explicit zero, and int64 so they round-trip exactly up to the BIGINT
+// limit rather than only to 2^53.
+type TrafficRecord struct {
+	SourceIP    string   `json:"source_ip" binding:"required,ip"`
+	DestIP      string   `json:"dest_ip" binding:"omitempty,ip"`
+	SourcePort  *int     `json:"source_port" binding:"omitempty,min=0,max=65535"`
+	DestPort    *int     `json:"dest_port" binding:"required,min=0,max=65535"`
+	Protocol    string   `json:"protocol" binding:"required,oneof=tcp udp icmp"`
+	Bytes       *int64   `json:"bytes" binding:"required,min=0"`
+	PacketCount *int64   `json:"packet_count" binding:"required,min=0"`
+	Duration    *float64 `json:"duration" binding:"omitempty,min=0"`
+
+	// SchemaVersion is the payload format the record was decoded from; see
+	// trafficDecoders.
+	SchemaVersion int `json:"schema_version"`
+
+	// Label is a verdict preset by the service, e.g. "benign" for
+	// allowlisted sources; it can't be supplied by the client.
+	Label string `json:"-"`
+
+	// SampleRate is the probability the record was kept with; see sampleIn.
+	// Zero is stored as 1. It can't be supplied by the client either.
+	SampleRate float64 `json:"-"`
+
+	// SyslogSeverity and Message are set for records received as syslog; see
+	// ingestSyslogTraffic.
+	SyslogSeverity *int   `json:"-"`
+	Message        string `json:"-"`
+
+	// ID and ReceivedAt are assigned when the record is stored; see
+	// stampTraffic.
+	ID         string    `json:"-"`
+	ReceivedAt time.Time `json:"-"`
+}
+
+// normalizeIPs rewrites source_ip and dest_ip in canonical form, so that one
+// address always groups as one value: IPv4-mapped IPv6 addresses become plain
+// IPv4 and IPv6 is printed in its shortest lower-case notation (RFC 5952).
+func (r *TrafficRecord) normalizeIPs() error {
+	source, err := canonicalIP(r.SourceIP)
+	if err != nil {
+		return fmt.Errorf("invalid source_ip: %w", err)
+	}
+	r.SourceIP = source
+	if r.DestIP != "" {
+		dest, err := canonicalIP(r.DestIP)
+		if err != nil {
+			return fmt.Errorf("invalid dest_ip: %w", err)
+		}
+		r.DestIP = dest
+	}
+	return nil
+}
+
+func canonicalIP(s string) (string, error) {
+	ip := net.ParseIP(strings.TrimSpace(s))
+	if ip == nil {
+		return "", fmt.Errorf("%q is not an IP address", s)
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.String(), nil
+	}
+	return ip.String(), nil
+}
+
+func nullableString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func durationOf(r TrafficRecord) float64 {
+	if r.Duration == nil {
+		return 0
+	}
+	return *r.Duration
+}
+
+// trafficArgsPerRow is the number of values insertArgs returns.
+const trafficArgsPerRow = 20
+
+// trafficPlaceholders returns one VALUES tuple for trafficInsertColumns whose
+// parameters start after offset.
+func trafficPlaceholders(offset int) string {
+	params := make([]string, 0, trafficArgsPerRow)
+	for i := 1; i <= trafficArgsPerRow; i++ {
+		params = append(params, fmt.Sprintf("$%d", offset+i))
+	}
+	return "(" + strings.Join(params, ", ") + ")"
+}
+
+// insertArgs returns the record's values in trafficInsertColumns order. The
+// record must be stamped, and the geo columns are looked up here so every
+// ingest path is enriched the same way.
+func (r TrafficRecord) insertArgs(tenant string) []interface{} {
+	geo := lookupGeo(r.SourceIP)
+	sampleRate := r.SampleRate
+	if sampleRate == 0 {
+		sampleRate = 1
+	}
+	return []interface{}{
+		r.ID, tenant, r.SourceIP, nullableString(r.DestIP), r.SourcePort, *r.DestPort,
+		r.Protocol, *r.Bytes, *r.PacketCount, durationOf(r), nullableString(r.Label), r.SchemaVersion,
+		geo.Country, geo.City, geo.ASN, geo.ASOrg, sampleRate, r.SyslogSeverity, nullableString(r.Message), r.ReceivedAt,
+	}
+}
+
+// ingestTraffic stores one record and answers 201. With ?mode=async the
+// validated record is queued instead and the answer is 202; it is inserted
+// shortly after by runAsyncIngestWorker and has no id yet.
+func ingestTraffic(c *gin.Context) {
+	mode := c.DefaultQuery("mode", "sync")
+	if mode != "sync" && mode != "async" {
+		respondIngest(c, 400, gin.H{"error": "invalid mode: must be sync or async"})
+		return
+	}
+
+	raw, err := bindTrafficRecord(c)
+	if err != nil {
+		if isBodyTooLarge(err) {
+			respondIngest(c, 413, gin.H{"error": "request body too large"})
+			return
+		}
+		ingestRecordsTotal.WithLabelValues("rejected").Inc()
+		respondIngest(c, 400, gin.H{"error": "invalid traffic record: " + err.Error()})
+		return
+	}
+	version, err := schemaVersionHeader(c)
+	if err != nil {
+		respondIngest(c, 400, gin.H{"error": err.Error()})
+		return
+	}
+	record, err := decodeTrafficRecord(raw, version)
+	if err != nil {
+		ingestRecordsTotal.WithLabelValues("rejected").Inc()
+		storeRejected(c, "ingest", version, []rejection{{Payload: raw, Reason: err.Error()}})
+		respondIngest(c, 400, gin.H{"error": "invalid traffic record: " + err.Error()})
+		return
+	}
+
+	lists, err := loadIPLists(c)
+	if err != nil {
+		requestLog(c).Error("Failed to load IP lists", "error", err)
+		internalError(c, "failed to store traffic record")
+		return
+	}
+	if entry := lists.match(record.SourceIP); entry != nil {
+		if entry.ListType == "deny" {
+			ingestRecordsTotal.WithLabelValues("rejected").Inc()
+			storeRejected(c, "ingest", version, []rejection{{Payload: raw, Reason: "source_ip is denylisted: " + entry.denyReason()}})
+			respondIngest(c, 403, gin.H{"error": "source_ip is denylisted", "reason": entry.denyReason()})
+			return
+		}
+		record.Label = "benign"
+	}
+
+	// Retries of the same record (or the same Idempotency-Key) replay the
+	// original response instead of inserting a duplicate row. Hashing after
+	// normalization means a retry in a different IP notation still matches.
+	recordJSON, _ := json.Marshal(record)
+	tenant := tenantFromContext(c)
+	dedupKey, done := beginIdempotent(c, "ingest:"+tenant, recordJSON)
+	if done {
+		return
+	}
+
+	if !sampleIn(&record) {
+		ingestRecordsTotal.WithLabelValues("sampled_out").Inc()
+		resp := gin.H{"status": "sampled_out"}
+		completeIdempotent(c, dedupKey, 202, resp)
+		respondIngest(c, 202, resp)
+		return
+	}
+
+	if mode == "async" {
+		if err := enqueueTraffic(c, tenant, record); err != nil {
+			requestLog(c).Error("Failed to queue traffic record", "error", err)
+			abandonIdempotent(c, dedupKey)
+			internalError(c, "failed to queue traffic record")
+			return
+		}
+		resp := gin.H{"status": "queued"}
+		completeIdempotent(c, dedupKey, 202, resp)
+		respondIngest(c, 202, resp)
+		return
+	}
+
+	records := []TrafficRecord{record}
+	if err := writeTraffic(c.Request.Context(), tenant, records); err != nil {
+		requestLog(c).Error("Failed to insert traffic record", "error", err)
+		abandonIdempotent(c, dedupKey)
+		internalError(c, "failed to store traffic record")
+		return
+	}
+
+	ingestRecordsTotal.WithLabelValues("accepted").Inc()
+	resp := gin.H{"id": records[0].ID, "received_at": records[0].ReceivedAt}
+	completeIdempotent(c, dedupKey, 201, resp)
+	respondIngest(c, 201, resp)
+}
+
+// RejectedRecord reports why a record in a batch was not accepted.
+type RejectedRecord struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+func ingestBatchTraffic(c *gin.Context) {
+	raw, err := bindTrafficBatch(c)
+	if err != nil {
+		if isBodyTooLarge(err) {
+			respondIngest(c, 413, gin.H{"error": "request body too large"})
+			return
+		}
+		respondIngest(c, 400, gin.H{"error": "invalid batch: " + err.Error()})
+		return
+	}
+	if len(raw) == 0 {
+		respondIngest(c, 400, gin.H{"error": "batch is empty"})
+		return
+	}
+	if len(raw) > maxBatchSize {
+		respondIngest(c, 413, gin.H{"error": fmt.Sprintf("batch of %d records exceeds the maximum of %d", len(raw), maxBatchSize)})
+		return
+	}
+
+	version, err := schemaVersionHeader(c)
+	if err != nil {
+		respondIngest(c, 400, gin.H{"error": err.Error()})
+		return
+	}
+	lists, err := loadIPLists(c)
+	if err != nil {
+		requestLog(c).Error("Failed to load IP lists", "error", err)
+		internalError(c, "failed to store traffic batch")
+		return
+	}
+
+	// Validate every record up front; invalid and denylisted ones are reported
+	// back by index while the rest of the batch is still inserted.
+	records := make([]TrafficRecord, 0, len(raw))
+	indexes := make([]int, 0, len(raw)) // position of each record in raw
+	rejected := []RejectedRecord{}
+	var dead []rejection
+	reject := func(i int, reason string) {
+		rejected = append(rejected, RejectedRecord{Index: i, Error: reason})
+		dead = append(dead, rejection{Payload: raw[i], Reason: reason})
+	}
+	for i, item := range raw {
+		record, err := decodeTrafficRecord(item, version)
+		if err != nil {
+			reject(i, err.Error())
+			continue
+		}
+		if entry := lists.match(record.SourceIP); entry != nil {
+			if entry.ListType == "deny" {
+				reject(i, "source_ip is denylisted: "+entry.denyReason())
+				continue
+			}
+			record.Label = "benign"
+		}
+		records = append(records, record)
+		indexes = append(indexes, i)
+	}
+
+	ingestRecordsTotal.WithLabelValues("rejected").Add(float64(len(rejected)))
+
+	if len(records) == 0 {
+		storeRejected(c, "batch", version, dead)
+		respondIngest(c, 400, gin.H{"error": "no valid records in batch", "accepted": 0, "rejected": rejected})
+		return
+	}
+
+	batchJSON, _ := json.Marshal(raw)
+	tenant := tenantFromContext(c)
+	dedupKey, done := beginIdempotent(c, "ingest-batch:"+tenant, batchJSON)
+	if done {
+		return
+	}
+
+	kept, keptIndexes := records[:0], indexes[:0]
+	for i, r := range records {
+		if sampleIn(&r) {
+			kept, keptIndexes = append(kept, r), append(keptIndexes, indexes[i])
+		}
+	}
+	sampledOut := len(records) - len(kept)
+	records, indexes = kept, keptIndexes
+
+	// Records of a failed chunk are reported as rejected and kept in the
+	// dead-letter store, so they can be replayed once the cause is fixed.
+	// Only when every chunk failed is the whole request an error.
+	chunks := insertTrafficChunks(c.Request.Context(), tenant, records)
+	failedChunks, failed := 0, 0
+	for n, chunk := range chunks {
+		if chunk.err == nil {
+			continue
+		}
+		failedChunks++
+		failed += chunk.end - chunk.start
+		requestLog(c).Error("Failed to insert traffic batch chunk", "chunk", n, "records", chunk.end-chunk.start, "error", chunk.err)
+		for _, i := range indexes[chunk.start:chunk.end] {
+			reject(i, fmt.Sprintf("not stored: chunk %d of the batch failed to insert", n))
+		}
+	}
+	if failedChunks > 0 && failedChunks == len(chunks) {
+		ingestRecordsTotal.WithLabelValues("sampled_out").Add(float64(sampledOut))
+		ingestRecordsTotal.WithLabelValues("failed").Add(float64(failed))
+		storeRejected(c, "batch", version, dead)
+		abandonIdempotent(c, dedupKey)
+		internalError(c, "failed to store traffic batch")
+		return
+	}
+
+	ingestRecordsTotal.WithLabelValues("accepted").Add(float64(len(records) - failed))
+	ingestRecordsTotal.WithLabelValues("sampled_out").Add(float64(sampledOut))
+	ingestRecordsTotal.WithLabelValues("failed").Add(float64(failed))
+	storeRejected(c, "batch", version, dead)
+	resp := gin.H{"accepted": len(records) - failed, "sampled_out": sampledOut, "rejected": rejected, "failed_chunks": failedChunks}
+	completeIdempotent(c, dedupKey, 201, resp)
+	respondIngest(c, 201, resp)
+}
+
+// insertTrafficBatch writes all records with one multi-row INSERT inside a
+// transaction, so the batch costs a single round trip.
+func insertTrafficBatch(ctx context.Context, tenant string, records []TrafficRecord) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertTrafficTx(ctx, tx, tenant, records); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// trafficChunk is a range of records inserted together, with the error that
+// rolled it back.
+type trafficChunk struct {
+	start, end int
+	err        error
+}
+
+// insertTrafficChunks writes records to the sinks batchChunkSize at a time,
+// each chunk in its own Postgres transaction, running up to
+// batchChunkConcurrency of them at once. A failed chunk doesn't stop the
+// others; every chunk is returned in order with its outcome.
+func insertTrafficChunks(ctx context.Context, tenant string, records []TrafficRecord) []trafficChunk {
+	var chunks []trafficChunk
+	for start := 0; start < len(records); start += batchChunkSize {
+		chunks = append(chunks, trafficChunk{start: start, end: min(start+batchChunkSize, len(records))})
+	}
+
+	sem := make(chan struct{}, batchChunkConcurrency)
+	var wg sync.WaitGroup
+	for i := range chunks {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(chunk *trafficChunk) {
+			defer func() { <-sem; wg.Done() }()
+			chunk.err = writeTraffic(ctx, tenant, records[chunk.start:chunk.end])
+		}(&chunks[i])
+	}
+	wg.Wait()
+	return chunks
+}
+
+// trafficBatchInsert builds the multi-row INSERT for records.
+func trafficBatchInsert(tenant string, records []TrafficRecord) (string, []interface{}) {
+	placeholders := make([]string, 0, len(records))
+	args := make([]interface{}, 0, len(records)*trafficArgsPerRow)
+	for i, r := range records {
+		placeholders = append(placeholders, trafficPlaceholders(i*trafficArgsPerRow))
+		args = append(args, r.insertArgs(tenant)...)
+	}
+	return "INSERT INTO traffic (" + trafficInsertColumns + ") VALUES " + strings.Join(placeholders, ", "), args
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// describeRecordError rewrites JSON type errors and validation failures of a
+// TrafficRecord as one message naming the JSON field and what it must be,
+// e.g. "dest_port must be an integer between 0 and 65535, got 70000". Other
+// errors are returned as they are.
+func describeRecordError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		got := strings.TrimPrefix(typeErr.Value, "number ")
+		return fmt.Errorf("%s must be %s, got %s", typeErr.Field, expectedValue(typeErr.Field), got)
+	}
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) && len(validationErrs) > 0 {
+		fe := validationErrs[0]
+		name := jsonFieldName(fe.StructField())
+		if fe.Tag() == "required" {
+			return fmt.Errorf("%s is required", name)
+		}
+		return fmt.Errorf("%s must be %s, got %v", name, expectedValue(name), fe.Value())
+	}
+	return err
+}
+
+// recordFields maps each JSON field of TrafficRecord to its struct field.
+var recordFields = func() map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	t := reflect.TypeOf(TrafficRecord{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); name != "" && name != "-" {
+			fields[name] = f
+		}
+	}
+	return fields
+}()
+
+func jsonFieldName(structField string) string {
+	for name, f := range recordFields {
+		if f.Name == structField {
+			return name
+		}
+	}
+	return structField
+}
+
+// expectedValue describes a valid value of the named field from its Go type
+// and binding tag, so the message always matches what is enforced.
+func expectedValue(name string) string {
+	f, ok := recordFields[name]
+	if !ok {
+		return "a valid value"
+	}
+	var min, max, oneof string
+	isIP := false
+	for _, rule := range strings.Split(f.Tag.Get("binding"), ",") {
+		key, value, _ := strings.Cut(rule, "=")
+		switch key {
+		case "min":
+			min = value
+		case "max":
+			max = value
+		case "oneof":
+			oneof = strings.ReplaceAll(value, " ", ", ")
+		case "ip":
+			isIP = true
+		}
+	}
+	switch {
+	case isIP:
+		return "an IP address"
+	case oneof != "":
+		return "one of " + oneof
+	}
+
+	t := f.Type
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	kind := "a number"
+	switch t.Kind() {
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		kind = "an integer"
+	case reflect.String:
+		return "a string"
+	}
+	switch {
+	case min != "" && max != "":
+		return fmt.Sprintf("%s between %s and %s", kind, min, max)
+	case min != "":
+		return fmt.Sprintf("%s of at least %s", kind, min)
+	case max != "":
+		return fmt.Sprintf("%s of at most %s", kind, max)
+	}
+	return kind
+}